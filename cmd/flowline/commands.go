@@ -2,10 +2,14 @@ package main
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/mmatongo/flowline/internal/confluence"
 	"github.com/mmatongo/flowline/internal/markdown"
 	"github.com/mmatongo/flowline/internal/outline"
 	"github.com/mmatongo/flowline/pkg/logger"
+	"github.com/mmatongo/flowline/utils"
 	"github.com/spf13/cobra"
 )
 
@@ -27,10 +31,25 @@ var outlineCmd = &cobra.Command{
 		collectionId, _ := cmd.Flags().GetString("collection")
 		verify, _ := cmd.Flags().GetBool("verify")
 		getCollections, _ := cmd.Flags().GetBool("get-collections")
+		staleBefore, _ := cmd.Flags().GetString("stale-before")
+		staleAction, _ := cmd.Flags().GetString("stale-action")
+		archiveCollection, _ := cmd.Flags().GetString("archive-collection")
+		createCollection, _ := cmd.Flags().GetBool("create-collection")
+		collectionPerPage, _ := cmd.Flags().GetBool("collection-per-page")
+		maxAttachmentSize, _ := cmd.Flags().GetString("max-attachment-size")
+		oversizePolicy, _ := cmd.Flags().GetString("oversize-policy")
+		attachmentLinkBase, _ := cmd.Flags().GetString("attachment-link-base")
+		userMap, _ := cmd.Flags().GetString("user-map")
+		mimeTypes, _ := cmd.Flags().GetStringToString("mime-type")
+		icon, _ := cmd.Flags().GetString("icon")
+		color, _ := cmd.Flags().GetString("color")
 
 		if getCollections {
 			if inputDir == "" && outputDir == "" && collectionId == "" {
-				res, err := outline.GetCollections(log)
+				nameFilter, _ := cmd.Flags().GetString("name")
+				format, _ := cmd.Flags().GetString("format")
+				withCounts, _ := cmd.Flags().GetBool("counts")
+				res, err := outline.GetCollections(nameFilter, format, withCounts, log)
 				if err != nil {
 					log.Logger.Error("failed to retrieve collections: ", err)
 					return
@@ -40,7 +59,8 @@ var outlineCmd = &cobra.Command{
 			}
 		}
 
-		if inputDir == "" || outputDir == "" && collectionId == "" {
+		hasTarget := collectionId != "" || createCollection || collectionPerPage
+		if inputDir == "" || outputDir == "" || !hasTarget {
 			err := cmd.Help()
 			if err != nil {
 				log.Logger.Error("failed to print help: ", err)
@@ -48,12 +68,65 @@ var outlineCmd = &cobra.Command{
 			return
 		}
 
-		if inputDir != "" && outputDir != "" && collectionId != "" {
-			if err := outline.PrepareAndProcess(inputDir, outputDir, collectionId, verify, log); err != nil {
-				log.Logger.Error("failed to process confluence export ", err)
+		opts := outline.Options{
+			InputPath:           inputDir,
+			OutputPath:          outputDir,
+			CollectionID:        collectionId,
+			CreateCollection:    createCollection,
+			CollectionPerPage:   collectionPerPage,
+			CollectionIcon:      icon,
+			CollectionColor:     color,
+			Verify:              verify,
+			Filter:              filterFromFlags(cmd),
+			StaleAction:         staleAction,
+			ArchiveCollectionID: archiveCollection,
+			OversizePolicy:      oversizePolicy,
+			AttachmentLinkBase:  attachmentLinkBase,
+			Images:              imageOptionsFromFlags(cmd),
+			Convert:             convertOptionsFromFlags(cmd),
+			UserMap:             userMap,
+		}
+
+		for ext, mimeType := range mimeTypes {
+			utils.RegisterMimeType(ext, mimeType)
+		}
+
+		if maxAttachmentSize != "" {
+			size, err := utils.ParseSize(maxAttachmentSize)
+			if err != nil {
+				log.Logger.Errorf("invalid --max-attachment-size: %v", err)
+				return
+			}
+			opts.MaxAttachmentSize = size
+		}
+
+		if staleBefore != "" {
+			cutoff, err := time.Parse("2006-01-02", staleBefore)
+			if err != nil {
+				log.Logger.Errorf("invalid --stale-before date %q, expected YYYY-MM-DD", staleBefore)
 				return
 			}
-			log.Print("processing completed successfully")
+			opts.StaleBefore = cutoff
+		}
+
+		if err := outline.PrepareAndProcess(opts, log); err != nil {
+			log.Logger.Error("failed to process confluence export ", err)
+			return
+		}
+		log.Print("processing completed successfully")
+	},
+}
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Delete everything a previous outline run created",
+	Long:  "Delete the documents, attachments and collections recorded in the manifest of a previous run, children before parents",
+	Run: func(cmd *cobra.Command, args []string) {
+		runID, _ := cmd.Flags().GetString("run")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		if err := outline.Rollback(runID, dryRun, log); err != nil {
+			log.Logger.Errorf("failed to roll back run %s: %v", runID, err)
 		}
 	},
 }
@@ -68,6 +141,9 @@ with the attachments in a separate directory within the page directory.`,
 		inputDir, _ := cmd.Flags().GetString("input")
 		outputDir, _ := cmd.Flags().GetString("output")
 		verify, _ := cmd.Flags().GetBool("verify")
+		dedupe, _ := cmd.Flags().GetBool("dedupe-attachments")
+		hardLink, _ := cmd.Flags().GetBool("hard-link")
+		userMap, _ := cmd.Flags().GetString("user-map")
 
 		if inputDir == "" || outputDir == "" {
 			err := cmd.Help()
@@ -77,7 +153,18 @@ with the attachments in a separate directory within the page directory.`,
 			return
 		}
 
-		if err := markdown.ExportToMarkdown(inputDir, outputDir, verify, log); err != nil {
+		opts := markdown.Options{
+			InputPath:         inputDir,
+			OutputPath:        outputDir,
+			Verify:            verify,
+			Filter:            filterFromFlags(cmd),
+			DedupeAttachments: dedupe,
+			HardLink:          hardLink,
+			Images:            imageOptionsFromFlags(cmd),
+			Convert:           convertOptionsFromFlags(cmd),
+			UserMap:           userMap,
+		}
+		if err := markdown.ExportToMarkdown(opts, log); err != nil {
 			log.Logger.Errorf("failed to convert confluence export: %v", err)
 			return
 		}
@@ -86,20 +173,116 @@ with the attachments in a separate directory within the page directory.`,
 	},
 }
 
+func addFilterFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArray("include", nil, "only migrate matching pages and their subtrees (title glob, id:<page id>, label:<glob> or under:<title/path>)")
+	cmd.Flags().StringArray("exclude", nil, "skip matching pages and their subtrees (same patterns as --include)")
+	cmd.Flags().Int("max-depth", 0, "maximum nesting depth to migrate, 0 for no limit")
+}
+
+func filterFromFlags(cmd *cobra.Command) confluence.Filter {
+	include, _ := cmd.Flags().GetStringArray("include")
+	exclude, _ := cmd.Flags().GetStringArray("exclude")
+	maxDepth, _ := cmd.Flags().GetInt("max-depth")
+
+	return confluence.Filter{
+		Include:  include,
+		Exclude:  exclude,
+		MaxDepth: maxDepth,
+	}
+}
+
+func addImageFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("optimize-images", false, "re-encode png and jpeg attachments, stripping their EXIF metadata")
+	cmd.Flags().Int("max-image-dimension", 0, "downscale optimized images larger than this width or height, 0 keeps the size")
+	cmd.Flags().Int("image-quality", 85, "jpeg quality of optimized images, 1 to 100")
+}
+
+func imageOptionsFromFlags(cmd *cobra.Command) utils.ImageOptions {
+	enabled, _ := cmd.Flags().GetBool("optimize-images")
+	maxDimension, _ := cmd.Flags().GetInt("max-image-dimension")
+	quality, _ := cmd.Flags().GetInt("image-quality")
+
+	return utils.ImageOptions{
+		Enabled:      enabled,
+		MaxDimension: maxDimension,
+		Quality:      quality,
+	}
+}
+
+func addConvertFlags(cmd *cobra.Command) {
+	cmd.Flags().String("jira-url", "", "base url of the jira instance jira macros link to, i.e. https://jira.example.com")
+	cmd.Flags().String("status-style", utils.StatusEmoji, "how status lozenges are shown: emoji or code")
+	cmd.Flags().StringToString("status-emoji", nil, "emoji of status lozenge colours, i.e. green=✅,red=⛔")
+	cmd.Flags().String("toc", "", "regenerate or drop table of contents macros, by default regenerated in markdown and dropped in outline")
+	cmd.Flags().String("math", utils.MathTeX, "convert math macros to tex, or keep their rendered image with image")
+	cmd.Flags().Bool("layout-rules", false, "separate the sections of page layouts with horizontal rules")
+	cmd.Flags().String("user-map", "", "csv mapping confluence usernames, user keys or account ids to the email or name of users")
+}
+
+func convertOptionsFromFlags(cmd *cobra.Command) utils.ConvertOptions {
+	jiraURL, _ := cmd.Flags().GetString("jira-url")
+	statusStyle, _ := cmd.Flags().GetString("status-style")
+	statusEmoji, _ := cmd.Flags().GetStringToString("status-emoji")
+	toc, _ := cmd.Flags().GetString("toc")
+	math, _ := cmd.Flags().GetString("math")
+	layoutRules, _ := cmd.Flags().GetBool("layout-rules")
+	layoutTables, _ := cmd.Flags().GetBool("layout-tables")
+	embedPDFs, _ := cmd.Flags().GetBool("embed-pdfs")
+
+	return utils.ConvertOptions{
+		JiraURL:      strings.TrimRight(jiraURL, "/"),
+		StatusStyle:  statusStyle,
+		StatusEmoji:  statusEmoji,
+		TOC:          toc,
+		Math:         math,
+		LayoutRules:  layoutRules,
+		LayoutTables: layoutTables,
+		EmbedPDFs:    embedPDFs,
+	}
+}
+
 func init() {
 	outlineCmd.Flags().StringP("input", "i", "", "path to the confluence HTML export")
 	outlineCmd.Flags().StringP("output", "o", "", "desired output path for the processed documents")
-	outlineCmd.Flags().StringP("collection", "c", "", "collection id to be populated")
+	outlineCmd.Flags().StringP("collection", "c", "", "id or name of the collection to be populated")
+	outlineCmd.Flags().Bool("create-collection", false, "create the collection from the confluence space name and description")
+	outlineCmd.Flags().Bool("collection-per-page", false, "create a collection for each top level page")
+	outlineCmd.Flags().String("icon", "", "icon of the created collections")
+	outlineCmd.Flags().String("color", "", "color of the created collections, i.e. #4E5C6E")
 	outlineCmd.Flags().BoolP("get-collections", "G", false, "retrieve a list of all the collections")
+	outlineCmd.Flags().String("name", "", "only list collections whose name contains this text (with -G)")
+	outlineCmd.Flags().String("format", "json", "output format of the collection list: table, json or csv (with -G)")
+	outlineCmd.Flags().Bool("counts", false, "include the number of documents in each collection (with -G)")
 	outlineCmd.Flags().BoolP("verify", "r", false, "verify the contents of each page before upload")
+	outlineCmd.Flags().String("max-attachment-size", "", "largest attachment to upload, i.e. 500MB")
+	outlineCmd.Flags().String("oversize-policy", outline.OversizeSkip, "what to do with larger attachments: skip or link")
+	outlineCmd.Flags().String("attachment-link-base", "", "url where the export is hosted, oversized attachments link there with the link policy")
+	outlineCmd.Flags().StringToString("mime-type", nil, "mime type overrides by extension, i.e. .drawio=application/vnd.jgraph.mxfile")
+	outlineCmd.Flags().String("stale-before", "", "treat pages last modified before this date (YYYY-MM-DD) as stale")
+	outlineCmd.Flags().String("stale-action", outline.StaleArchive, "what to do with stale pages: archive, skip or mark")
+	outlineCmd.Flags().String("archive-collection", "", "id or name of the collection that receives stale pages when archiving")
+	addFilterFlags(outlineCmd)
+	addImageFlags(outlineCmd)
+	addConvertFlags(outlineCmd)
+
+	outlineCmd.MarkFlagsMutuallyExclusive("collection", "create-collection", "collection-per-page")
+
+	rollbackCmd.Flags().String("run", "", "id of the run to roll back")
+	rollbackCmd.Flags().Bool("dry-run", false, "only list what would be deleted")
 
-	outlineCmd.MarkFlagRequired("input")
-	outlineCmd.MarkFlagRequired("output")
-	outlineCmd.MarkFlagRequired("collection")
+	rollbackCmd.MarkFlagRequired("run")
+	outlineCmd.AddCommand(rollbackCmd)
 
 	markdownCmd.Flags().StringP("input", "i", "", "path to the confluence HTML export")
 	markdownCmd.Flags().StringP("output", "o", "", "output path for the markdown files")
 	markdownCmd.Flags().BoolP("verify", "r", false, "verify before proceeding with conversion")
+	markdownCmd.Flags().Bool("dedupe-attachments", false, "store a single copy of identical attachments")
+	markdownCmd.Flags().Bool("hard-link", false, "hard link duplicate attachments into each page instead of linking to the first copy")
+	addFilterFlags(markdownCmd)
+	addImageFlags(markdownCmd)
+	addConvertFlags(markdownCmd)
+	markdownCmd.Flags().Bool("layout-tables", false, "keep the columns of page layouts side by side in an html table")
+	markdownCmd.Flags().Bool("embed-pdfs", false, "embed the pdfs of view file macros below their link")
 
 	markdownCmd.MarkFlagRequired("input")
 	markdownCmd.MarkFlagRequired("output")
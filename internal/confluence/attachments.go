@@ -0,0 +1,86 @@
+package confluence
+
+import (
+	"html"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+type Attachment struct {
+	// Path is relative to the export, i.e. attachments/123/456.png
+	Path string
+	Name string
+}
+
+// ExtractAttachments lists the attachments of a page from its "Attachments" section and from
+// the attachments/<pageID>/ folder of the export. The section is removed from the document as
+// its links are not part of the page body.
+func ExtractAttachments(doc *goquery.Document, inputPath, pageID string) []Attachment {
+	var attachments []Attachment
+	seen := make(map[string]bool)
+
+	add := func(path, name string) {
+		if seen[path] {
+			return
+		}
+		seen[path] = true
+		attachments = append(attachments, Attachment{Path: path, Name: name})
+	}
+
+	doc.Find(".pageSection").Each(func(i int, section *goquery.Selection) {
+		if section.Find("#attachments").Length() == 0 {
+			return
+		}
+		section.Find("a[href^='attachments/']").Each(func(i int, s *goquery.Selection) {
+			href, _ := s.Attr("href")
+			path := strings.Split(href, "?")[0]
+			name := strings.TrimSpace(s.Text())
+			if name == "" {
+				name = filepath.Base(path)
+			}
+			add(path, name)
+		})
+		section.Remove()
+	})
+
+	if pageID == "" {
+		return attachments
+	}
+
+	entries, err := os.ReadDir(filepath.Join(inputPath, "attachments", pageID))
+	if err != nil {
+		return attachments
+	}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			add("attachments/"+pageID+"/"+entry.Name(), entry.Name())
+		}
+	}
+
+	return attachments
+}
+
+// AppendAttachmentList appends an "Attachments" list linking to the given attachments, whose
+// Path is the link target, to the page content.
+func AppendAttachmentList(doc *goquery.Document, attachments []Attachment) {
+	if len(attachments) == 0 {
+		return
+	}
+
+	content := doc.Find("#main-content").First()
+	if content.Length() == 0 {
+		content = doc.Find("body").First()
+	}
+
+	var list strings.Builder
+	list.WriteString("<h2>Attachments</h2><ul>")
+	for _, attachment := range attachments {
+		list.WriteString(`<li><a href="` + html.EscapeString(attachment.Path) + `">` + html.EscapeString(attachment.Name) + "</a></li>")
+	}
+	list.WriteString("</ul>")
+
+	content.AppendHtml(list.String())
+}
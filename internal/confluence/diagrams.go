@@ -0,0 +1,116 @@
+package confluence
+
+import (
+	"bytes"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+type diagramKind struct {
+	label    string
+	selector string
+	sources  []string
+}
+
+var diagramKinds = []diagramKind{
+	{
+		label:    "draw.io",
+		selector: "[data-macro-name='drawio'], [data-macro-name='inc-drawio'], .drawio-macro",
+		sources:  []string{"", ".drawio", ".drawio.xml", ".xml", ".drawio.svg", ".svg"},
+	},
+	{
+		label:    "Gliffy",
+		selector: "[data-macro-name='gliffy'], .gliffy-container, .gliffy-macro, img.gliffy-image",
+		sources:  []string{"", ".gliffy"},
+	},
+}
+
+// RewriteDiagrams replaces draw.io and Gliffy macros with their rendered preview as the inline
+// image and a link to the editable source. draw.io sources saved as svg are displayed directly.
+func RewriteDiagrams(doc *goquery.Document, attachments []Attachment, inputPath string) {
+	byName := make(map[string]string)
+	byPath := make(map[string]string)
+	for _, attachment := range attachments {
+		byName[attachment.Name] = attachment.Path
+		byPath[attachment.Path] = attachment.Name
+	}
+
+	for _, kind := range diagramKinds {
+		doc.Find(kind.selector).Each(func(i int, macro *goquery.Selection) {
+			if macro.ParentsFiltered(kind.selector).Length() > 0 {
+				return
+			}
+
+			name, preview := diagramName(macro, byPath)
+			if name == "" {
+				return
+			}
+			if preview == "" {
+				preview = byName[name+".png"]
+			}
+
+			var source string
+			for _, ext := range kind.sources {
+				if path, ok := byName[name+ext]; ok && path != preview {
+					source = path
+					break
+				}
+			}
+
+			if source != "" && isSVG(filepath.Join(inputPath, source)) {
+				preview = source
+			}
+
+			if preview == "" && source == "" {
+				return
+			}
+
+			var replacement strings.Builder
+			if preview != "" {
+				replacement.WriteString(`<p><img src="` + html.EscapeString(preview) + `" alt="` + html.EscapeString(name) + `"/></p>`)
+			}
+			if source != "" {
+				replacement.WriteString(`<p><a href="` + html.EscapeString(source) + `">` + html.EscapeString(name) + " (" + kind.label + " source)</a></p>")
+			}
+			macro.ReplaceWithHtml(replacement.String())
+		})
+	}
+}
+
+// diagramName finds the name of the diagram of a macro and the preview image it already shows.
+func diagramName(macro *goquery.Selection, byPath map[string]string) (string, string) {
+	var preview string
+	if src, ok := macro.Filter("img").AddSelection(macro.Find("img")).First().Attr("src"); ok && strings.HasPrefix(src, "attachments/") {
+		preview = strings.Split(src, "?")[0]
+	}
+
+	for _, attr := range []string{"data-diagram-name", "data-diagramname", "data-name"} {
+		if name, ok := macro.Attr(attr); ok && name != "" {
+			return name, preview
+		}
+	}
+
+	if preview != "" {
+		if name, ok := byPath[preview]; ok {
+			return strings.TrimSuffix(name, filepath.Ext(name)), preview
+		}
+	}
+	return "", preview
+}
+
+func isSVG(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	head := make([]byte, 1024)
+	n, _ := io.ReadFull(file, head)
+	return bytes.Contains(head[:n], []byte("<svg"))
+}
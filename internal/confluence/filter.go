@@ -0,0 +1,177 @@
+package confluence
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Filter selects which pages of the export should be migrated.
+//
+// Include and Exclude take patterns of the following forms:
+//
+//	Runbook*               a glob matched against the page title
+//	id:123456              a confluence page id
+//	label:ops-*            a glob matched against the page labels
+//	under:Platform/Runbook the page at the given title path (and everything below it)
+//
+// A page matched by an include pattern is migrated together with its subtree, an excluded
+// page is dropped together with its subtree. MaxDepth limits the nesting of the result,
+// 1 being the top level; 0 means no limit.
+type Filter struct {
+	Include  []string
+	Exclude  []string
+	MaxDepth int
+}
+
+// Apply returns a filtered copy of the page tree, the tree itself is left as is. inputPath is
+// the root of the export and is only read when a label pattern is used, the labels are then
+// loaded onto the input pages.
+func (f *Filter) Apply(pages []*Page, inputPath string) []*Page {
+	pages = dedupe(pages)
+
+	if f.usesLabels() {
+		loadLabels(pages, inputPath)
+	}
+
+	selected := f.filter(pages, "", len(f.Include) == 0)
+	return limitDepth(selected, f.MaxDepth, 1)
+}
+
+func (f *Filter) filter(pages []*Page, parentPath string, included bool) []*Page {
+	var result []*Page
+	for _, page := range pages {
+		titlePath := path.Join(parentPath, page.Title)
+		if matchAny(f.Exclude, page, titlePath) {
+			continue
+		}
+
+		pageIncluded := included || matchAny(f.Include, page, titlePath)
+		children := f.filter(page.Children, titlePath, pageIncluded)
+
+		if !pageIncluded {
+			// promote included descendants so they are not lost with their parent
+			result = append(result, children...)
+			continue
+		}
+
+		clone := *page
+		clone.Children = children
+		result = append(result, &clone)
+	}
+	return result
+}
+
+func (f *Filter) usesLabels() bool {
+	for _, pattern := range append(append([]string{}, f.Include...), f.Exclude...) {
+		if strings.HasPrefix(pattern, "label:") {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, page *Page, titlePath string) bool {
+	for _, pattern := range patterns {
+		if match(pattern, page, titlePath) {
+			return true
+		}
+	}
+	return false
+}
+
+func match(pattern string, page *Page, titlePath string) bool {
+	switch {
+	case strings.HasPrefix(pattern, "id:"):
+		return page.ID != "" && page.ID == strings.TrimPrefix(pattern, "id:")
+	case strings.HasPrefix(pattern, "label:"):
+		for _, label := range page.Labels {
+			if glob(strings.TrimPrefix(pattern, "label:"), label) {
+				return true
+			}
+		}
+		return false
+	case strings.HasPrefix(pattern, "under:"):
+		root := strings.Trim(strings.TrimPrefix(pattern, "under:"), "/")
+		return glob(root, titlePath)
+	default:
+		return glob(pattern, page.Title)
+	}
+}
+
+func glob(pattern, value string) bool {
+	matched, err := path.Match(strings.ToLower(pattern), strings.ToLower(value))
+	return err == nil && matched
+}
+
+func limitDepth(pages []*Page, maxDepth, depth int) []*Page {
+	if maxDepth <= 0 {
+		return pages
+	}
+	for _, page := range pages {
+		if depth >= maxDepth {
+			page.Children = nil
+			continue
+		}
+		page.Children = limitDepth(page.Children, maxDepth, depth+1)
+	}
+	return pages
+}
+
+// dedupe drops top level entries that also appear nested under another page, ProcessHTML
+// collects every list in the index so nested pages are reported more than once.
+func dedupe(pages []*Page) []*Page {
+	nested := make(map[string]bool)
+	var collect func([]*Page)
+	collect = func(children []*Page) {
+		for _, child := range children {
+			nested[child.URL] = true
+			collect(child.Children)
+		}
+	}
+	for _, page := range pages {
+		collect(page.Children)
+	}
+
+	var result []*Page
+	for _, page := range pages {
+		if !nested[page.URL] {
+			result = append(result, page)
+		}
+	}
+	return result
+}
+
+// loadLabels reads the labels of the pages from the export and sets them on the pages.
+func loadLabels(pages []*Page, inputPath string) {
+	for _, page := range pages {
+		if page.Labels == nil && page.URL != "" {
+			page.Labels = readLabels(filepath.Join(inputPath, page.URL))
+		}
+		loadLabels(page.Children, inputPath)
+	}
+}
+
+func readLabels(pagePath string) []string {
+	file, err := os.Open(pagePath)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	doc, err := goquery.NewDocumentFromReader(file)
+	if err != nil {
+		return nil
+	}
+
+	labels := []string{}
+	doc.Find(".labels-content a, a.label, .aui-label a, a[rel='tag']").Each(func(i int, s *goquery.Selection) {
+		if label := strings.TrimSpace(s.Text()); label != "" {
+			labels = append(labels, label)
+		}
+	})
+	return labels
+}
@@ -0,0 +1,103 @@
+package confluence
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testPages returns the tree
+//
+//	Platform (1)
+//	  Runbooks (2)
+//	    Deploy (3)
+//	  Draft notes (4)
+//	Team (5)
+//	  Onboarding (6)
+func testPages() []*Page {
+	deploy := &Page{ID: "3", Title: "Deploy", URL: "Deploy_3.html"}
+	runbooks := &Page{ID: "2", Title: "Runbooks", URL: "Runbooks_2.html", Children: []*Page{deploy}}
+	draft := &Page{ID: "4", Title: "Draft notes", URL: "Draft-notes_4.html"}
+	onboarding := &Page{ID: "6", Title: "Onboarding", URL: "Onboarding_6.html"}
+	return []*Page{
+		{ID: "1", Title: "Platform", URL: "Platform_1.html", Children: []*Page{runbooks, draft}},
+		{ID: "5", Title: "Team", URL: "Team_5.html", Children: []*Page{onboarding}},
+		// ProcessHTML reports nested pages at the top level as well
+		runbooks,
+	}
+}
+
+// tree renders pages as "Title(Child,Child)" for comparison.
+func tree(pages []*Page) string {
+	var titles []string
+	for _, page := range pages {
+		title := page.Title
+		if len(page.Children) > 0 {
+			title += "(" + tree(page.Children) + ")"
+		}
+		titles = append(titles, title)
+	}
+	return strings.Join(titles, ",")
+}
+
+func TestFilterApply(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		want   string
+	}{
+		{"everything", Filter{}, "Platform(Runbooks(Deploy),Draft notes),Team(Onboarding)"},
+		{"title glob brings the subtree", Filter{Include: []string{"run*"}}, "Runbooks(Deploy)"},
+		{"page id", Filter{Include: []string{"id:6"}}, "Onboarding"},
+		{"title path", Filter{Include: []string{"under:Platform/Runbooks"}}, "Runbooks(Deploy)"},
+		{"title path glob", Filter{Include: []string{"under:*/Onboarding"}}, "Onboarding"},
+		{"exclude drops the subtree", Filter{Exclude: []string{"Runbooks"}}, "Platform(Draft notes),Team(Onboarding)"},
+		{"exclude within an include", Filter{Include: []string{"Platform"}, Exclude: []string{"draft*"}}, "Platform(Runbooks(Deploy))"},
+		{"included descendants of excluded pages are dropped", Filter{Include: []string{"Deploy"}, Exclude: []string{"Platform"}}, ""},
+		{"max depth", Filter{MaxDepth: 2}, "Platform(Runbooks,Draft notes),Team(Onboarding)"},
+		{"max depth counts from the included pages", Filter{Include: []string{"Platform"}, MaxDepth: 1}, "Platform"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pages := testPages()
+			if got := tree(tt.filter.Apply(pages, "")); got != tt.want {
+				t.Errorf("Apply() = %q, want %q", got, tt.want)
+			}
+			if got := tree(pages[:2]); got != "Platform(Runbooks(Deploy),Draft notes),Team(Onboarding)" {
+				t.Errorf("Apply() changed the input tree to %q", got)
+			}
+		})
+	}
+}
+
+func TestFilterApplyLabels(t *testing.T) {
+	inputPath := t.TempDir()
+	labels := map[string]string{
+		"Runbooks_2.html":    `<div class="labels-content"><a href="#">ops-runbook</a></div>`,
+		"Draft-notes_4.html": `<a class="label" href="#">draft</a>`,
+	}
+	for name, body := range labels {
+		if err := os.WriteFile(filepath.Join(inputPath, name), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   string
+	}{
+		{"include", Filter{Include: []string{"label:ops-*"}}, "Runbooks(Deploy)"},
+		{"exclude", Filter{Exclude: []string{"label:draft"}}, "Platform(Runbooks(Deploy)),Team(Onboarding)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tree(tt.filter.Apply(testPages(), inputPath)); got != tt.want {
+				t.Errorf("Apply() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
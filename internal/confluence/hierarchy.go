@@ -1,15 +1,40 @@
 package confluence
 
 import (
+	"path"
+	"regexp"
 	"strings"
 
 	"golang.org/x/net/html"
+
+	"github.com/mmatongo/flowline/utils"
 )
 
 type Page struct {
-	Title    string
-	URL      string
-	Children []*Page
+	ID         string
+	Title      string
+	URL        string
+	Labels     []string
+	Properties []utils.Property
+	Children   []*Page
+}
+
+// PageNodes returns the page tree as the page nodes of the macro conversion and fills nodes
+// with the node of each page. Properties have to be loaded before.
+func PageNodes(pages []*Page, nodes map[*Page]*utils.PageNode) []*utils.PageNode {
+	var result []*utils.PageNode
+	for _, page := range pages {
+		node := &utils.PageNode{
+			ID:         page.ID,
+			Title:      page.Title,
+			URL:        page.URL,
+			Properties: page.Properties,
+			Children:   PageNodes(page.Children, nodes),
+		}
+		nodes[page] = node
+		result = append(result, node)
+	}
+	return result
 }
 
 func ProcessHTML(n *html.Node) []*Page {
@@ -69,7 +94,7 @@ func extractPageInfo(n *html.Node) *Page {
 		}
 	}
 	title = strings.TrimSpace(extractText(n))
-	return &Page{Title: title, URL: url}
+	return &Page{ID: pageID(url), Title: title, URL: url}
 }
 
 func extractText(n *html.Node) string {
@@ -82,3 +107,14 @@ func extractText(n *html.Node) string {
 	}
 	return text
 }
+
+var pageIDPattern = regexp.MustCompile(`(?:^|_)(\d+)\.html$`)
+
+// pageID extracts the numeric confluence page id from an exported page file name,
+// i.e. "Runbooks_123456.html" or "123456.html".
+func pageID(url string) string {
+	if m := pageIDPattern.FindStringSubmatch(path.Base(url)); m != nil {
+		return m[1]
+	}
+	return ""
+}
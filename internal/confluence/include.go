@@ -0,0 +1,137 @@
+package confluence
+
+import (
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const includeSelector = "[data-macro-name='include'], [data-macro-name='excerpt-include']"
+
+// the placeholder Confluence exports when it could not render the macro
+var missingInclude = regexp.MustCompile(`(?i)page to include called:\s*(.+)$`)
+
+// InlineIncludes replaces include page and excerpt include macros by the content of the page
+// they include, read from the export, with a note naming that page. pages is every page of the
+// export. Includes leading back to a page that is already being included are left out.
+func InlineIncludes(doc *goquery.Document, inputPath, pageID string, pages []*Page) {
+	var stack []string
+	if page := findPageByID(pages, pageID); page != nil {
+		stack = append(stack, page.URL)
+	}
+	inlineIncludes(doc.Selection, inputPath, pages, stack)
+}
+
+func inlineIncludes(content *goquery.Selection, inputPath string, pages []*Page, stack []string) {
+	content.Find(includeSelector).Each(func(i int, macro *goquery.Selection) {
+		if macro.ParentsFiltered(includeSelector).Length() > 0 {
+			return
+		}
+
+		source := findPageByTitle(pages, includedTitle(macro))
+		if source == nil {
+			return
+		}
+
+		for _, url := range stack {
+			if url == source.URL {
+				macro.ReplaceWithHtml("<p><em>" + html.EscapeString(source.Title) + " is not included again as it includes this page</em></p>")
+				return
+			}
+		}
+
+		htmlContent, err := os.ReadFile(filepath.Join(inputPath, source.URL))
+		if err != nil {
+			return
+		}
+		sourceDoc, err := goquery.NewDocumentFromReader(strings.NewReader(string(htmlContent)))
+		if err != nil {
+			return
+		}
+
+		included := sourceDoc.Find("#main-content").First()
+		if included.Length() == 0 {
+			included = sourceDoc.Find("body").First()
+		}
+		if macro.AttrOr("data-macro-name", "") == "excerpt-include" {
+			included = included.Find("[data-macro-name='excerpt']").First()
+			if included.Length() == 0 {
+				return
+			}
+		}
+
+		inlineIncludes(included, inputPath, pages, append(stack, source.URL))
+
+		body, err := included.Html()
+		if err != nil {
+			return
+		}
+		macro.ReplaceWithHtml("<div><p><em>Included from " + html.EscapeString(source.Title) + "</em></p>" + body + "</div>")
+	})
+}
+
+// includedTitle finds the title of the included page in the attributes of the macro, the
+// panel title of excerpt includes or the placeholder of a missing include.
+func includedTitle(macro *goquery.Selection) string {
+	for _, attr := range []string{"data-page-title", "data-title"} {
+		if title := strings.TrimSpace(macro.AttrOr(attr, "")); title != "" {
+			return title
+		}
+	}
+
+	if title := strings.TrimSpace(macro.Find(".panelHeader").First().Text()); title != "" {
+		return title
+	}
+
+	if match := missingInclude.FindStringSubmatch(strings.TrimSpace(macro.Text())); match != nil {
+		return strings.TrimSpace(match[1])
+	}
+	return ""
+}
+
+func findPageByID(pages []*Page, id string) *Page {
+	if id == "" {
+		return nil
+	}
+	for _, page := range pages {
+		if page.ID == id {
+			return page
+		}
+		if found := findPageByID(page.Children, id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// findPageByTitle also accepts titles prefixed with a space key, i.e. OPS:Support hours.
+func findPageByTitle(pages []*Page, title string) *Page {
+	if title == "" {
+		return nil
+	}
+
+	var find func([]*Page, string) *Page
+	find = func(pages []*Page, title string) *Page {
+		for _, page := range pages {
+			if strings.EqualFold(page.Title, title) {
+				return page
+			}
+			if found := find(page.Children, title); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+
+	if page := find(pages, title); page != nil {
+		return page
+	}
+	if _, unprefixed, ok := strings.Cut(title, ":"); ok {
+		return find(pages, strings.TrimSpace(unprefixed))
+	}
+	return nil
+}
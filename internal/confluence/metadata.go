@@ -0,0 +1,32 @@
+package confluence
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var metadataDate = regexp.MustCompile(`[A-Z][a-z]{2} \d{1,2}, \d{4}`)
+
+// LastModified returns the last modified (or created) date from the page metadata of an
+// exported page, i.e. "Created by John Smith, last modified by Jane Doe on Mar 05, 2019".
+func LastModified(htmlContent string) (time.Time, bool) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	metadata := doc.Find(".page-metadata").First().Text()
+	dates := metadataDate.FindAllString(metadata, -1)
+	if len(dates) == 0 {
+		return time.Time{}, false
+	}
+
+	modified, err := time.Parse("Jan 2, 2006", dates[len(dates)-1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return modified, true
+}
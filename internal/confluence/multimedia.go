@@ -0,0 +1,36 @@
+package confluence
+
+import (
+	"html"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const mediaSelector = "embed[src^='attachments/'], object[data^='attachments/'], video[src^='attachments/'], audio[src^='attachments/'], source[src^='attachments/']"
+
+// RewriteMultimedia replaces multimedia macros playing an attached video or audio file by a link
+// to the file on a line of its own, so the file is migrated like any other attachment.
+func RewriteMultimedia(doc *goquery.Document, attachments []Attachment) {
+	names := make(map[string]string)
+	for _, attachment := range attachments {
+		names[attachment.Path] = attachment.Name
+	}
+
+	doc.Find(mediaSelector).Each(func(i int, media *goquery.Selection) {
+		src := media.AttrOr("src", media.AttrOr("data", ""))
+		path := strings.Split(src, "?")[0]
+
+		name, ok := names[path]
+		if !ok {
+			name = filepath.Base(path)
+		}
+
+		macro := media.Closest("[data-macro-name='multimedia'], .confluence-embedded-file-wrapper, video, audio")
+		if macro.Length() == 0 {
+			macro = media
+		}
+		macro.ReplaceWithHtml(`<p><a href="` + html.EscapeString(path) + `">` + html.EscapeString(name) + "</a></p>")
+	})
+}
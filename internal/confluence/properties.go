@@ -0,0 +1,68 @@
+package confluence
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/mmatongo/flowline/utils"
+)
+
+// LoadProperties reads the page properties of the pages and their children from the export.
+func LoadProperties(pages []*Page, inputPath string) {
+	for _, page := range pages {
+		if page.Properties == nil && page.URL != "" {
+			page.Properties = readProperties(filepath.Join(inputPath, page.URL))
+		}
+		LoadProperties(page.Children, inputPath)
+	}
+}
+
+func readProperties(pagePath string) []utils.Property {
+	file, err := os.Open(pagePath)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	doc, err := goquery.NewDocumentFromReader(file)
+	if err != nil {
+		return nil
+	}
+	return PageProperties(doc.Selection)
+}
+
+// PageProperties returns the key and value rows of the page properties macros in content,
+// keys are only listed once.
+func PageProperties(content *goquery.Selection) []utils.Property {
+	properties := []utils.Property{}
+	seen := make(map[string]bool)
+
+	content.Find(utils.PropertiesSelector).Find("tr").Each(func(i int, row *goquery.Selection) {
+		cells := row.ChildrenFiltered("th, td")
+		if cells.Length() < 2 {
+			return
+		}
+
+		key := strings.Join(strings.Fields(cells.Eq(0).Text()), " ")
+		if key == "" || seen[strings.ToLower(key)] {
+			return
+		}
+		seen[strings.ToLower(key)] = true
+
+		value := cells.Eq(1)
+		var items []string
+		value.Find("li").Each(func(i int, li *goquery.Selection) {
+			items = append(items, strings.Join(strings.Fields(li.Text()), " "))
+		})
+		text := strings.Join(items, ", ")
+		if len(items) == 0 {
+			text = strings.Join(strings.Fields(value.Text()), " ")
+		}
+
+		properties = append(properties, utils.Property{Key: key, Value: text})
+	})
+	return properties
+}
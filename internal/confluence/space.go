@@ -0,0 +1,42 @@
+package confluence
+
+import (
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+type Space struct {
+	Key         string
+	Name        string
+	Description string
+}
+
+// SpaceDetails reads the "Space Details" table from the index.html of an export,
+// falling back to the document title for the name.
+func SpaceDetails(htmlContent string) Space {
+	var space Space
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
+	if err != nil {
+		return space
+	}
+
+	doc.Find("table tr").Each(func(i int, tr *goquery.Selection) {
+		key := strings.TrimSpace(tr.Find("th").First().Text())
+		value := strings.TrimSpace(tr.Find("td").First().Text())
+		switch strings.TrimSuffix(key, ":") {
+		case "Key":
+			space.Key = value
+		case "Name":
+			space.Name = value
+		case "Description":
+			space.Description = value
+		}
+	})
+
+	if space.Name == "" {
+		space.Name = strings.TrimSpace(doc.Find("title").First().Text())
+	}
+	return space
+}
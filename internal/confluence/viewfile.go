@@ -0,0 +1,57 @@
+package confluence
+
+import (
+	"html"
+	"mime"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const viewFileSelector = "[data-macro-name='viewfile'], [data-macro-name='view-file'], [data-macro-name='viewdoc'], [data-macro-name='viewxls'], [data-macro-name='viewppt'], [data-macro-name='viewpdf'], .confluence-embedded-file-wrapper, a.confluence-embedded-file"
+
+// inlineParents are the elements a view file macro is inline in, it is not given a paragraph
+// of its own there.
+const inlineParents = "p, span, a, em, strong, b, i, u, h1, h2, h3, h4, h5, h6"
+
+// RewriteViewFiles replaces the previews of view file macros, a thumbnail of an attached office
+// document or pdf, by a link to the attached file named after it. The links carry the file
+// type in data-view-file so pdfs can be embedded later on. Embedded images share the wrapper
+// of view file macros and are left alone.
+func RewriteViewFiles(doc *goquery.Document, attachments []Attachment) {
+	names := make(map[string]string)
+	for _, attachment := range attachments {
+		names[attachment.Path] = attachment.Name
+	}
+
+	doc.Find(viewFileSelector).Each(func(i int, macro *goquery.Selection) {
+		if macro.ParentsFiltered(viewFileSelector).Length() > 0 || macro.Find("img.confluence-embedded-image").Length() > 0 {
+			return
+		}
+
+		file := macro.Filter("a[href^='attachments/']").AddSelection(macro.Find("a[href^='attachments/']")).First()
+		if file.Length() == 0 {
+			return
+		}
+
+		path := strings.Split(file.AttrOr("href", ""), "?")[0]
+		name, ok := names[path]
+		if !ok {
+			name = file.AttrOr("data-linked-resource-default-alias", filepath.Base(path))
+		}
+
+		contentType := file.AttrOr("data-linked-resource-content-type", mime.TypeByExtension(filepath.Ext(name)))
+		if strings.HasPrefix(contentType, "image/") {
+			return
+		}
+
+		fileType := strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), ".")
+		link := `<a href="` + html.EscapeString(path) + `" data-view-file="` + html.EscapeString(fileType) + `">` + html.EscapeString(name) + "</a>"
+		if macro.ParentsFiltered(inlineParents).Length() > 0 {
+			macro.ReplaceWithHtml(link)
+			return
+		}
+		macro.ReplaceWithHtml("<p>" + link + "</p>")
+	})
+}
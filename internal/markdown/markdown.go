@@ -3,6 +3,7 @@ package markdown
 import (
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -14,13 +15,52 @@ import (
 	"golang.org/x/net/html"
 )
 
-func ExportToMarkdown(inputPath, outputPath string, verify bool, a *logger.App) error {
-	if err := os.MkdirAll(outputPath, os.ModePerm); err != nil {
+// Options configures a markdown export.
+type Options struct {
+	InputPath  string
+	OutputPath string
+	Verify     bool
+	Filter     confluence.Filter
+
+	// DedupeAttachments keeps a single copy of identical attachments, pages reference the
+	// first copy unless HardLink is set, in which case every page gets a hard link to it.
+	DedupeAttachments bool
+	HardLink          bool
+
+	Images  utils.ImageOptions
+	Convert utils.ConvertOptions
+	// UserMap is the csv mapping Confluence users to the names they are mentioned as
+	UserMap string
+}
+
+// export holds the state of a single run.
+type export struct {
+	Options
+	processed map[string]bool
+	copies    map[string]string
+	pages     []*confluence.Page
+	// exported is every page of the export, including the ones left out by the filter
+	exported []*confluence.Page
+	// paths maps the url of each exported page to its markdown file, relative to the output
+	paths map[string]string
+	// tree is the page tree the macros see, nodes maps each page to its node in it
+	tree  []*utils.PageNode
+	nodes map[*confluence.Page]*utils.PageNode
+
+	imageBytesSaved int64
+}
+
+func ExportToMarkdown(opts Options, a *logger.App) error {
+	if err := opts.Convert.Validate(); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(opts.OutputPath, os.ModePerm); err != nil {
 		a.Logger.Errorf("failed to create output directory: %v", err)
 		return err
 	}
 
-	htmlContent, err := os.ReadFile(filepath.Join(inputPath, "index.html"))
+	htmlContent, err := os.ReadFile(filepath.Join(opts.InputPath, "index.html"))
 	if err != nil {
 		a.Logger.Errorf("failed to read index.html: %v", err)
 		return err
@@ -32,20 +72,104 @@ func ExportToMarkdown(inputPath, outputPath string, verify bool, a *logger.App)
 		return err
 	}
 
-	processed := make(map[string]bool)
-	pages := confluence.ProcessHTML(doc)
-	return processMarkdownPages(pages, inputPath, outputPath, verify, a, "", processed)
+	e := &export{
+		Options:   opts,
+		processed: make(map[string]bool),
+		copies:    make(map[string]string),
+	}
+	e.Convert.Report = &utils.Report{}
+
+	if opts.UserMap != "" {
+		mapping, err := utils.LoadUserMap(opts.UserMap)
+		if err != nil {
+			return err
+		}
+		e.Convert.Users = make(map[string]utils.User)
+		for confluenceUser, name := range mapping {
+			// emails are not shown, the mention keeps the display name of the export
+			if strings.Contains(name, "@") {
+				name = ""
+			}
+			e.Convert.Users[confluenceUser] = utils.User{Name: name}
+		}
+	}
+
+	e.exported = confluence.ProcessHTML(doc)
+	e.pages = opts.Filter.Apply(e.exported, opts.InputPath)
+	confluence.LoadProperties(e.pages, opts.InputPath)
+	e.nodes = make(map[*confluence.Page]*utils.PageNode)
+	e.tree = confluence.PageNodes(e.pages, e.nodes)
+	e.paths = make(map[string]string)
+	markdownPaths(e.pages, "", e.paths)
+
+	if err := processMarkdownPages(e.pages, e, a, ""); err != nil {
+		return err
+	}
+
+	if e.Convert.Report.Len() > 0 {
+		reportPath := filepath.Join(opts.OutputPath, "report.csv")
+		if err := e.Convert.Report.Write(reportPath); err != nil {
+			a.Logger.Errorf("failed to write conversion report: %v", err)
+		} else {
+			a.Print(e.Convert.Report.Len(), " conversion issues written to: ", reportPath)
+		}
+	}
+
+	if opts.Images.Enabled {
+		a.Print("image optimization saved ", utils.FormatSize(e.imageBytesSaved))
+	}
+	return nil
 }
 
-func processMarkdownPages(pages []*confluence.Page, inputPath, outputPath string, verify bool, a *logger.App, currentPath string, processed map[string]bool) error {
+// markdownPaths computes where each page is written the same way processMarkdownPages does,
+// so pages can link to pages that are not converted yet.
+func markdownPaths(pages []*confluence.Page, currentPath string, paths map[string]string) {
 	for _, page := range pages {
-		if processed[page.URL] {
+		if _, ok := paths[page.URL]; ok {
 			continue
 		}
 
-		processed[page.URL] = true
 		pagePath := filepath.Join(currentPath, sanitizeFilename(page.Title))
-		fullOutputPath := filepath.Join(outputPath, pagePath)
+		paths[page.URL] = filepath.Join(pagePath, filepath.Base(pagePath)+".md")
+		markdownPaths(page.Children, pagePath, paths)
+	}
+}
+
+// pageLink returns the relative link from the page written to outputDir to the page exported
+// to pageURL.
+func (e *export) pageLink(outputDir, pageURL string) string {
+	path, ok := e.paths[pageURL]
+	if !ok {
+		return ""
+	}
+
+	rel, err := filepath.Rel(outputDir, filepath.Join(e.OutputPath, path))
+	if err != nil {
+		return ""
+	}
+
+	return escapePath(rel)
+}
+
+// escapePath turns a relative file path into a link, escaping each of its segments since page
+// folders are named after page titles.
+func escapePath(path string) string {
+	segments := strings.Split(filepath.ToSlash(path), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func processMarkdownPages(pages []*confluence.Page, e *export, a *logger.App, currentPath string) error {
+	for _, page := range pages {
+		if e.processed[page.URL] {
+			continue
+		}
+
+		e.processed[page.URL] = true
+		pagePath := filepath.Join(currentPath, sanitizeFilename(page.Title))
+		fullOutputPath := filepath.Join(e.OutputPath, pagePath)
 
 		if err := os.MkdirAll(fullOutputPath, os.ModePerm); err != nil {
 			a.Logger.Errorf("failed to create directory %s: %v", fullOutputPath, err)
@@ -53,10 +177,10 @@ func processMarkdownPages(pages []*confluence.Page, inputPath, outputPath string
 		}
 
 		err := processMarkdownFile(
-			page.Title,
-			filepath.Join(inputPath, page.URL),
+			page,
+			filepath.Join(e.InputPath, page.URL),
 			fullOutputPath,
-			verify,
+			e,
 			a,
 		)
 		if err != nil {
@@ -65,7 +189,7 @@ func processMarkdownPages(pages []*confluence.Page, inputPath, outputPath string
 		}
 
 		if len(page.Children) > 0 {
-			err = processMarkdownPages(page.Children, inputPath, outputPath, verify, a, pagePath, processed)
+			err = processMarkdownPages(page.Children, e, a, pagePath)
 			if err != nil {
 				a.Logger.Errorf("error processing children of %s: %v", page.Title, err)
 			}
@@ -74,23 +198,30 @@ func processMarkdownPages(pages []*confluence.Page, inputPath, outputPath string
 	return nil
 }
 
-func processMarkdownFile(_, inputPath, outputDir string, verify bool, a *logger.App) error {
+func processMarkdownFile(page *confluence.Page, inputPath, outputDir string, e *export, a *logger.App) error {
 	htmlContent, err := os.ReadFile(inputPath)
 	if err != nil {
 		return fmt.Errorf("failed to read file %s: %v", inputPath, err)
 	}
 
-	processedHTML, err := processAndCopyAttachments(string(htmlContent), filepath.Dir(inputPath), outputDir, a)
+	processedHTML, err := processAndCopyAttachments(string(htmlContent), filepath.Dir(inputPath), outputDir, page.ID, e, a)
 	if err != nil {
 		return fmt.Errorf("failed to process attachments: %v", err)
 	}
 
-	_, markdownContent, err := utils.ConvertHTMLToMarkdown(processedHTML, a)
+	convert := e.Convert
+	convert.Target = utils.TargetMarkdown
+	convert.Page = e.nodes[page]
+	convert.Pages = e.tree
+	convert.PageLink = func(pageURL string) string {
+		return e.pageLink(outputDir, pageURL)
+	}
+	_, markdownContent, err := utils.ConvertHTMLToMarkdown(processedHTML, convert, a)
 	if err != nil {
 		return fmt.Errorf("failed to convert to markdown: %v", err)
 	}
 
-	if verify {
+	if e.Verify {
 		a.Print("markdown content for: ", inputPath)
 		fmt.Println(strings.Repeat("=", 50))
 		fmt.Println(markdownContent)
@@ -116,38 +247,55 @@ func processMarkdownFile(_, inputPath, outputDir string, verify bool, a *logger.
 	return nil
 }
 
-func processAndCopyAttachments(htmlContent, sourcePath, outputDir string, a *logger.App) (string, error) {
+func processAndCopyAttachments(htmlContent, sourcePath, outputDir, pageID string, e *export, a *logger.App) (string, error) {
 	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
 	if err != nil {
 		return "", err
 	}
 
 	attachmentsDir := filepath.Join(outputDir, "attachments")
-
-	processElement := func(s *goquery.Selection, attr string) error {
-		src, exists := s.Attr(attr)
-		if !exists || !strings.HasPrefix(src, "attachments/") {
-			return nil
-		}
-
-		cleanSrc := utils.CleanPath(src)
+	confluence.InlineIncludes(doc, sourcePath, pageID, e.exported)
+	pageAttachments := confluence.ExtractAttachments(doc, sourcePath, pageID)
+	confluence.RewriteDiagrams(doc, pageAttachments, sourcePath)
+	confluence.RewriteMultimedia(doc, pageAttachments)
+	confluence.RewriteViewFiles(doc, pageAttachments)
+	referenced := make(map[string]bool)
+
+	copyAttachment := func(cleanSrc string) (string, error) {
 		srcPath := filepath.Join(sourcePath, cleanSrc)
 
 		if _, err := os.Stat(srcPath); err != nil {
 			a.Logger.Printf("attachment file not found: %s", srcPath)
-			return nil
+			return "", nil
 		}
 
 		if err := os.MkdirAll(attachmentsDir, os.ModePerm); err != nil {
-			return fmt.Errorf("failed to create attachments directory: %v", err)
+			return "", fmt.Errorf("failed to create attachments directory: %v", err)
 		}
 
 		destPath := filepath.Join(attachmentsDir, filepath.Base(cleanSrc))
-		if err := copyFile(srcPath, destPath); err != nil {
-			return fmt.Errorf("failed to copy attachment: %v", err)
+		link, err := e.storeAttachment(srcPath, destPath, outputDir, a)
+		if err != nil {
+			return "", fmt.Errorf("failed to copy attachment: %v", err)
+		}
+		return link, nil
+	}
+
+	processElement := func(s *goquery.Selection, attr string) error {
+		src, exists := s.Attr(attr)
+		if !exists || !strings.HasPrefix(src, "attachments/") {
+			return nil
 		}
 
-		s.SetAttr(attr, fmt.Sprintf("attachments/%s", filepath.Base(cleanSrc)))
+		cleanSrc := utils.CleanPath(src)
+		referenced[cleanSrc] = true
+
+		link, err := copyAttachment(cleanSrc)
+		if err != nil || link == "" {
+			return err
+		}
+
+		s.SetAttr(attr, link)
 		return nil
 	}
 
@@ -167,6 +315,25 @@ func processAndCopyAttachments(htmlContent, sourcePath, outputDir string, a *log
 		}
 	})
 
+	// files that are attached to the page but never referenced in its body
+	var unreferenced []confluence.Attachment
+	for _, attachment := range pageAttachments {
+		cleanSrc := utils.CleanPath(attachment.Path)
+		if referenced[cleanSrc] {
+			continue
+		}
+
+		link, err := copyAttachment(cleanSrc)
+		if err != nil {
+			a.Logger.Printf("error processing attachment: %v", err)
+			continue
+		}
+		if link != "" {
+			unreferenced = append(unreferenced, confluence.Attachment{Path: link, Name: attachment.Name})
+		}
+	}
+	confluence.AppendAttachmentList(doc, unreferenced)
+
 	html, err := doc.Html()
 	if err != nil {
 		return "", fmt.Errorf("failed to generate HTML: %v", err)
@@ -175,6 +342,58 @@ func processAndCopyAttachments(htmlContent, sourcePath, outputDir string, a *log
 	return html, nil
 }
 
+// storeAttachment copies the attachment to destPath and returns the link to use from a page
+// in pageDir. With deduplication, identical files are linked to (or hard linked from) the first copy.
+func (e *export) storeAttachment(srcPath, destPath, pageDir string, a *logger.App) (string, error) {
+	link := func(path string) string {
+		rel, err := filepath.Rel(pageDir, path)
+		if err != nil {
+			return escapePath(path)
+		}
+		return escapePath(rel)
+	}
+
+	if !e.DedupeAttachments {
+		return link(destPath), e.copyAttachment(srcPath, destPath, a)
+	}
+
+	hash, err := utils.HashFile(srcPath)
+	if err != nil {
+		return "", err
+	}
+
+	first, ok := e.copies[hash]
+	if !ok {
+		e.copies[hash] = destPath
+		return link(destPath), e.copyAttachment(srcPath, destPath, a)
+	}
+
+	if first == destPath || !e.HardLink {
+		return link(first), nil
+	}
+
+	os.Remove(destPath)
+	if err := os.Link(first, destPath); err != nil {
+		// i.e. the file system does not support hard links
+		return link(destPath), e.copyAttachment(srcPath, destPath, a)
+	}
+	return link(destPath), nil
+}
+
+// copyAttachment writes an optimized version of images and a plain copy of anything else.
+func (e *export) copyAttachment(srcPath, destPath string, a *logger.App) error {
+	ok, saved, err := utils.OptimizeImage(srcPath, destPath, e.Images)
+	if err != nil {
+		a.Logger.Printf("failed to optimize image %s: %v", srcPath, err)
+	}
+	if ok {
+		e.imageBytesSaved += saved
+		a.Logger.Printf("optimized image %s, saved %s", srcPath, utils.FormatSize(saved))
+		return nil
+	}
+	return copyFile(srcPath, destPath)
+}
+
 func copyFile(src, dst string) error {
 	sourceFile, err := os.Open(src)
 	if err != nil {
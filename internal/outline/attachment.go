@@ -12,12 +12,18 @@ import (
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/mmatongo/flowline/internal/confluence"
 	"github.com/mmatongo/flowline/pkg/config"
 	"github.com/mmatongo/flowline/pkg/logger"
 	"github.com/mmatongo/flowline/rate"
 	"github.com/mmatongo/flowline/utils"
 )
 
+const (
+	OversizeSkip = "skip"
+	OversizeLink = "link"
+)
+
 type AttachmentPayload struct {
 	Name        string `json:"name"`
 	ContentType string `json:"contentType"`
@@ -46,11 +52,6 @@ func createAttachment(filePath string, a *logger.App) (map[string]interface{}, e
 	fileSize := fileInfo.Size()
 	mimeType := utils.GetMimeType(filePath)
 
-	if mimeType == "" {
-		a.Logger.Errorf("cannot determine mimetype of %v, skipping...", filePath)
-		return nil, nil
-	}
-
 	payload := AttachmentPayload{
 		Name:        fileName,
 		ContentType: mimeType,
@@ -118,8 +119,10 @@ func createAttachment(filePath string, a *logger.App) (map[string]interface{}, e
 	}
 	defer file.Close()
 
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
+	// the multipart body is streamed from the file, only the part headers and the closing
+	// boundary are kept in memory so the content length is known up front
+	head := &bytes.Buffer{}
+	writer := multipart.NewWriter(head)
 
 	for key, value := range form {
 		if err := writer.WriteField(key, fmt.Sprintf("%v", value)); err != nil {
@@ -127,23 +130,35 @@ func createAttachment(filePath string, a *logger.App) (map[string]interface{}, e
 		}
 	}
 
-	part, err := writer.CreateFormFile("file", fileName)
-	if err != nil {
+	if _, err := writer.CreateFormFile("file", fileName); err != nil {
 		return nil, fmt.Errorf("failed to create form file: %w", err)
 	}
 
-	if _, err := io.Copy(part, file); err != nil {
-		return nil, fmt.Errorf("failed to copy file content: %w", err)
-	}
-
+	headBytes := append([]byte(nil), head.Bytes()...)
+	head.Reset()
 	if err := writer.Close(); err != nil {
 		return nil, fmt.Errorf("failed to close multipart writer: %w", err)
 	}
+	tailBytes := head.Bytes()
+
+	body, pw := io.Pipe()
+	go func() {
+		_, err := pw.Write(headBytes)
+		if err == nil {
+			_, err = io.Copy(pw, newProgressReader(file, fileName, fileSize, a))
+		}
+		if err == nil {
+			_, err = pw.Write(tailBytes)
+		}
+		pw.CloseWithError(err)
+	}()
 
 	uploadReq, err := http.NewRequest("POST", uploadURL, body)
 	if err != nil {
+		body.Close()
 		return nil, fmt.Errorf("failed to create upload request: %w", err)
 	}
+	uploadReq.ContentLength = int64(len(headBytes)) + fileSize + int64(len(tailBytes))
 
 	uploadReq.Header.Set("Authorization", "Bearer "+cfg.APIKey)
 	uploadReq.Header.Set("Content-Type", writer.FormDataContentType())
@@ -167,6 +182,35 @@ func createAttachment(filePath string, a *logger.App) (map[string]interface{}, e
 	}, nil
 }
 
+// progressReader logs the upload progress of large files in steps of 10%.
+type progressReader struct {
+	r        io.Reader
+	name     string
+	size     int64
+	read     int64
+	reported int64
+	a        *logger.App
+}
+
+const progressThreshold = 10 << 20
+
+func newProgressReader(r io.Reader, name string, size int64, a *logger.App) io.Reader {
+	if size < progressThreshold {
+		return r
+	}
+	return &progressReader{r: r, name: name, size: size, a: a}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+	if percent := p.read * 100 / p.size; percent >= p.reported+10 {
+		p.reported = percent - percent%10
+		p.a.Logger.Printf("uploading %s: %d%% of %s", p.name, p.reported, utils.FormatSize(p.size))
+	}
+	return n, err
+}
+
 func getAttachmentURL(attachmentInfo map[string]interface{}) string {
 	cfg := config.NewConfig()
 	if key, ok := attachmentInfo["key"].(string); ok {
@@ -175,35 +219,145 @@ func getAttachmentURL(attachmentInfo map[string]interface{}) string {
 	return ""
 }
 
-func uploadAndReplaceAttachments(htmlContent, basePath string, a *logger.App) (string, error) {
+// oversized applies the oversize policy to attachments larger than the maximum size, returning
+// the link that replaces the reference for the link policy.
+func (m *migration) oversized(srcPath string, size int64, a *logger.App) (string, bool) {
+	if m.MaxAttachmentSize <= 0 || size <= m.MaxAttachmentSize {
+		return "", false
+	}
+
+	if m.OversizePolicy == OversizeLink && m.AttachmentLinkBase != "" {
+		rel, err := filepath.Rel(m.InputPath, srcPath)
+		if err == nil {
+			a.Logger.Printf("attachment %s is %s, linking instead of uploading", srcPath, utils.FormatSize(size))
+			return strings.TrimSuffix(m.AttachmentLinkBase, "/") + "/" + filepath.ToSlash(rel), true
+		}
+	}
+
+	a.Logger.Printf("attachment %s is %s, skipping", srcPath, utils.FormatSize(size))
+	return "", true
+}
+
+// optimizeImage returns the path of an optimized copy of the image to upload in its place, or
+// srcPath itself when optimization is disabled or does not help.
+func (m *migration) optimizeImage(srcPath string, a *logger.App) string {
+	if !m.Images.Enabled {
+		return srcPath
+	}
+
+	if m.imageDir == "" {
+		dir, err := os.MkdirTemp("", "flowline-images-")
+		if err != nil {
+			a.Logger.Errorf("failed to create directory for optimized images: %v", err)
+			return srcPath
+		}
+		m.imageDir = dir
+	}
+
+	// keep the file name, it becomes the name of the attachment
+	dir, err := os.MkdirTemp(m.imageDir, "")
+	if err != nil {
+		return srcPath
+	}
+	dst := filepath.Join(dir, filepath.Base(srcPath))
+
+	ok, saved, err := utils.OptimizeImage(srcPath, dst, m.Images)
+	if err != nil {
+		a.Logger.Printf("failed to optimize image %s: %v", srcPath, err)
+		return srcPath
+	}
+	if !ok {
+		return srcPath
+	}
+
+	m.imageBytesSaved += saved
+	a.Logger.Printf("optimized image %s, saved %s", srcPath, utils.FormatSize(saved))
+	return dst
+}
+
+// uploadAttachment uploads the file unless a file with the same content was uploaded before,
+// in which case the earlier attachment is reused.
+func uploadAttachment(srcPath string, m *migration, a *logger.App) (map[string]interface{}, error) {
+	hash, err := m.attachments.hash(srcPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if attachment := m.attachments.get(hash); attachment != nil {
+		a.Logger.Printf("reusing attachment %v for %s", attachment["name"], srcPath)
+		// the attachment may come from an earlier run, this run uses it as well
+		id, _ := attachment["id"].(string)
+		key, _ := attachment["key"].(string)
+		m.record(m.manifest.addAttachment(id, filepath.Base(srcPath), key), a)
+		return attachment, nil
+	}
+
+	attachment, err := createAttachment(m.optimizeImage(srcPath, a), a)
+	if err != nil || attachment == nil {
+		return attachment, err
+	}
+
+	id, _ := attachment["id"].(string)
+	key, _ := attachment["key"].(string)
+	m.record(m.manifest.addAttachment(id, filepath.Base(srcPath), key), a)
+
+	if err := m.attachments.put(hash, attachment); err != nil {
+		a.Logger.Errorf("failed to save attachment cache: %v", err)
+	}
+	return attachment, nil
+}
+
+// attachmentLink uploads the attachment at srcPath and returns the link that replaces references
+// to it, an empty link means the reference is kept as is.
+func attachmentLink(srcPath string, m *migration, a *logger.App) string {
+	info, err := os.Stat(srcPath)
+	if err != nil {
+		a.Logger.Printf("attachment file not found: %s", srcPath)
+		return ""
+	}
+
+	if link, oversized := m.oversized(srcPath, info.Size(), a); oversized {
+		return link
+	}
+
+	attachment, err := uploadAttachment(srcPath, m, a)
+	if err != nil {
+		a.Logger.Printf("failed to upload attachment %s. error: %v", srcPath, err)
+		return ""
+	}
+
+	if attachment == nil {
+		return ""
+	}
+
+	attachmentURL := getAttachmentURL(attachment)
+	if attachmentURL == "" {
+		a.Logger.Printf("failed to get URL for attachment %s. keeping original reference.", srcPath)
+	}
+	return attachmentURL
+}
+
+func uploadAndReplaceAttachments(htmlContent, basePath, pageID string, m *migration, a *logger.App) (string, error) {
 	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
 	if err != nil {
 		return "", err
 	}
 
+	confluence.InlineIncludes(doc, basePath, pageID, m.exported)
+	pageAttachments := confluence.ExtractAttachments(doc, basePath, pageID)
+	confluence.RewriteDiagrams(doc, pageAttachments, basePath)
+	confluence.RewriteMultimedia(doc, pageAttachments)
+	confluence.RewriteViewFiles(doc, pageAttachments)
+	referenced := make(map[string]bool)
+
 	processElement := func(s *goquery.Selection, attr string) {
 		src, exists := s.Attr(attr)
 		if exists && strings.HasPrefix(src, "attachments/") {
 			cleanSrc := utils.CleanPath(src)
-			srcPath := filepath.Join(basePath, cleanSrc)
-
-			if _, err := os.Stat(srcPath); err == nil {
-				attachment, err := createAttachment(srcPath, a)
-				if err != nil {
-					a.Logger.Printf("failed to upload attachment %s. error: %v", srcPath, err)
-					return
-				}
-
-				if attachment != nil {
-					attachmentURL := getAttachmentURL(attachment)
-					if attachmentURL != "" {
-						s.SetAttr(attr, attachmentURL)
-					} else {
-						a.Logger.Printf("failed to get URL for attachment %s. keeping original reference.", srcPath)
-					}
-				}
-			} else {
-				a.Logger.Printf("attachment file not found: %s", srcPath)
+			referenced[cleanSrc] = true
+
+			if link := attachmentLink(filepath.Join(basePath, cleanSrc), m, a); link != "" {
+				s.SetAttr(attr, link)
 			}
 		}
 	}
@@ -220,5 +374,17 @@ func uploadAndReplaceAttachments(htmlContent, basePath string, a *logger.App) (s
 		processElement(s, "href")
 	})
 
+	// files that are attached to the page but never referenced in its body
+	var unreferenced []confluence.Attachment
+	for _, attachment := range pageAttachments {
+		if referenced[utils.CleanPath(attachment.Path)] {
+			continue
+		}
+		if link := attachmentLink(filepath.Join(basePath, attachment.Path), m, a); link != "" {
+			unreferenced = append(unreferenced, confluence.Attachment{Path: link, Name: attachment.Name})
+		}
+	}
+	confluence.AppendAttachmentList(doc, unreferenced)
+
 	return doc.Html()
 }
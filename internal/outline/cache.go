@@ -0,0 +1,88 @@
+package outline
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/mmatongo/flowline/utils"
+)
+
+const attachmentCacheFile = "attachments.json"
+
+// attachmentCache maps the sha256 of an attachment to the attachment it was uploaded as, it is
+// kept in the output directory so that resumed runs reuse uploads of earlier runs.
+type attachmentCache struct {
+	path    string
+	entries map[string]map[string]interface{}
+	hashes  map[string]string
+}
+
+func loadAttachmentCache(outputPath string) (*attachmentCache, error) {
+	c := &attachmentCache{
+		path:    filepath.Join(outputPath, attachmentCacheFile),
+		entries: make(map[string]map[string]interface{}),
+		hashes:  make(map[string]string),
+	}
+
+	content, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, &c.entries); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// hash returns the content hash of the file at path, each path is only read once per run.
+func (c *attachmentCache) hash(path string) (string, error) {
+	if hash, ok := c.hashes[path]; ok {
+		return hash, nil
+	}
+
+	hash, err := utils.HashFile(path)
+	if err != nil {
+		return "", err
+	}
+	c.hashes[path] = hash
+	return hash, nil
+}
+
+func (c *attachmentCache) get(hash string) map[string]interface{} {
+	return c.entries[hash]
+}
+
+func (c *attachmentCache) put(hash string, attachment map[string]interface{}) error {
+	c.entries[hash] = attachment
+	return c.save()
+}
+
+// forget drops the attachments with the given keys, i.e. after they were rolled back.
+func (c *attachmentCache) forget(keys map[string]bool) error {
+	changed := false
+	for hash, attachment := range c.entries {
+		if key, _ := attachment["key"].(string); keys[key] {
+			delete(c.entries, hash)
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+	return c.save()
+}
+
+func (c *attachmentCache) save() error {
+	content, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, content, 0644)
+}
@@ -1,29 +1,221 @@
 package outline
 
 import (
+	"bytes"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"text/tabwriter"
 
 	"github.com/mmatongo/flowline/pkg/config"
 	"github.com/mmatongo/flowline/pkg/logger"
+	"github.com/mmatongo/flowline/rate"
 )
 
 type Collection struct {
-	Name string `json:"name"`
-	ID   string `json:"id"`
-	URL  string `json:"url"`
+	Name       string `json:"name"`
+	ID         string `json:"id"`
+	URL        string `json:"url"`
+	Permission string `json:"permission"`
+	Documents  *int   `json:"documents,omitempty"`
 }
 
-func GetCollections(a *logger.App) (string, error) {
+const collectionsPageSize = 100
+
+type CollectionPayload struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Icon        string `json:"icon,omitempty"`
+	Color       string `json:"color,omitempty"`
+}
+
+// GetCollections lists the collections whose name contains nameFilter, formatted as a table,
+// json or csv. Counting documents takes a (rate limited) request per collection so it is optional.
+func GetCollections(nameFilter, format string, withCounts bool, a *logger.App) (string, error) {
+	if format != "table" && format != "json" && format != "csv" {
+		return "", fmt.Errorf("unknown format %q, expected table, json or csv", format)
+	}
+
+	collections, err := listCollections(a)
+	if err != nil {
+		return "", err
+	}
+
+	var filtered []Collection
+	for _, collection := range collections {
+		if strings.Contains(strings.ToLower(collection.Name), strings.ToLower(nameFilter)) {
+			filtered = append(filtered, collection)
+		}
+	}
+
+	for i := 0; withCounts && i < len(filtered); i++ {
+		count, err := countDocuments(filtered[i].ID, a)
+		if err != nil {
+			a.Logger.Errorf("failed to count documents of %s: %v", filtered[i].Name, err)
+			continue
+		}
+		filtered[i].Documents = &count
+	}
+
+	switch format {
+	case "table":
+		var buf bytes.Buffer
+		w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tID\tPERMISSION\tDOCUMENTS\tURL")
+		for _, c := range filtered {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", c.Name, c.ID, c.Permission, c.documentCount(), c.URL)
+		}
+		if err := w.Flush(); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	case "csv":
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.Write([]string{"name", "id", "permission", "documents", "url"})
+		for _, c := range filtered {
+			w.Write([]string{c.Name, c.ID, c.Permission, c.documentCount(), c.URL})
+		}
+		w.Flush()
+		return buf.String(), w.Error()
+	default:
+		output, err := json.MarshalIndent(filtered, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal collections to JSON: %w", err)
+		}
+		return string(output), nil
+	}
+}
+
+// documentCount formats the number of documents, - when they were not counted.
+func (c Collection) documentCount() string {
+	if c.Documents == nil {
+		return "-"
+	}
+	return strconv.Itoa(*c.Documents)
+}
+
+// ResolveCollection returns the id of the collection matching nameOrID, either by id or by
+// its (case insensitive) name.
+func ResolveCollection(nameOrID string, a *logger.App) (string, error) {
+	collections, err := listCollections(a)
+	if err != nil {
+		return "", err
+	}
+
+	for _, collection := range collections {
+		if collection.ID == nameOrID {
+			return collection.ID, nil
+		}
+	}
+
+	var matches []Collection
+	for _, collection := range collections {
+		if strings.EqualFold(collection.Name, nameOrID) {
+			matches = append(matches, collection)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no collection named or with id %q", nameOrID)
+	case 1:
+		return matches[0].ID, nil
+	default:
+		return "", fmt.Errorf("%d collections are named %q, use the collection id instead", len(matches), nameOrID)
+	}
+}
+
+// listCollections pages through collections.list and returns every collection of the workspace.
+func listCollections(a *logger.App) ([]Collection, error) {
 	cfg := config.NewConfig()
 	url := fmt.Sprintf("%s/collections.list", cfg.BaseURL)
 
-	req, err := http.NewRequest("POST", url, nil)
+	var collections []Collection
+	for offset := 0; ; offset += collectionsPageSize {
+		rate.LimitRequest(a)
+		payloadBytes, err := json.Marshal(map[string]int{"offset": offset, "limit": collectionsPageSize})
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequest("POST", url, bytes.NewBuffer(payloadBytes))
+		if err != nil {
+			a.Logger.Errorf("error making document request, %s", err)
+			return nil, err
+		}
+
+		req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := cfg.Client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		bodyBytes, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading response body")
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("error status code %v", resp.StatusCode)
+		}
+
+		var result map[string]interface{}
+		if err := json.Unmarshal(bodyBytes, &result); err != nil {
+			return nil, fmt.Errorf("error unmarshalling json %w", err)
+		}
+
+		data, ok := result["data"].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("'data' field not found in response")
+		}
+
+		for _, item := range data {
+			if collection, ok := item.(map[string]interface{}); ok {
+				name, _ := collection["name"].(string)
+				id, _ := collection["id"].(string)
+				url, _ := collection["url"].(string)
+				permission, _ := collection["permission"].(string)
+				if permission == "" {
+					permission = "private"
+				}
+				collections = append(collections, Collection{
+					Name:       name,
+					ID:         id,
+					URL:        cfg.BaseURL + url,
+					Permission: permission,
+				})
+			}
+		}
+
+		if len(data) < collectionsPageSize {
+			return collections, nil
+		}
+	}
+}
+
+// countDocuments counts the documents in the navigation tree of a collection.
+func countDocuments(collectionID string, a *logger.App) (int, error) {
+	cfg := config.NewConfig()
+	rate.LimitRequest(a)
+	url := fmt.Sprintf("%s/collections.documents", cfg.BaseURL)
+
+	payloadBytes, err := json.Marshal(map[string]string{"id": collectionID})
 	if err != nil {
-		a.Logger.Errorf("error making document request, %s", err)
-		return "", err
+		return 0, err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return 0, err
 	}
 
 	req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
@@ -32,47 +224,75 @@ func GetCollections(a *logger.App) (string, error) {
 
 	resp, err := cfg.Client.Do(req)
 	if err != nil {
-		return "", err
+		return 0, err
 	}
 	defer resp.Body.Close()
 
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("error reading response body")
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("error status code %v", resp.StatusCode)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("error status code %v", resp.StatusCode)
+	type node struct {
+		Children []node `json:"children"`
+	}
+	var result struct {
+		Data []node `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, err
 	}
 
-	var result map[string]interface{}
-	if err := json.Unmarshal(bodyBytes, &result); err != nil {
-		return "", fmt.Errorf("error unmarshalling json %W", err)
+	var count func([]node) int
+	count = func(nodes []node) int {
+		total := len(nodes)
+		for _, n := range nodes {
+			total += count(n.Children)
+		}
+		return total
 	}
+	return count(result.Data), nil
+}
+
+func createCollection(payload CollectionPayload, a *logger.App) (Collection, error) {
+	cfg := config.NewConfig()
+	rate.LimitRequest(a)
+	url := fmt.Sprintf("%s/collections.create", cfg.BaseURL)
 
-	data, ok := result["data"].([]interface{})
-	if !ok {
-		return "", fmt.Errorf("'data' field not found in response")
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		a.Logger.Errorf("error marshalling collection payload, %s", err)
+		return Collection{}, err
 	}
 
-	var collections []Collection
-	for _, item := range data {
-		if collection, ok := item.(map[string]interface{}); ok {
-			name, _ := collection["name"].(string)
-			id, _ := collection["id"].(string)
-			url, _ := collection["url"].(string)
-			collections = append(collections, Collection{
-				Name: name,
-				ID:   id,
-				URL:  cfg.BaseURL + url,
-			})
-		}
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		a.Logger.Errorf("error making collection request, %s", err)
+		return Collection{}, err
 	}
 
-	output, err := json.MarshalIndent(collections, "", "  ")
+	req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := cfg.Client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal collections to JSON: %w", err)
+		return Collection{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return Collection{}, fmt.Errorf("failed to create collection: %s - %s", resp.Status, string(bodyBytes))
+	}
+
+	var result struct {
+		Data Collection `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Collection{}, err
 	}
 
-	return string(output), nil
+	a.Print("successfully created collection: ", result.Data.Name)
+	result.Data.URL = cfg.BaseURL + result.Data.URL
+	return result.Data, nil
 }
@@ -67,3 +67,34 @@ func createDocument(title, text, collectionID, parentDocumentID string, a *logge
 	a.Print("successfully created document: ", title)
 	return result["data"].(map[string]interface{}), nil
 }
+
+func updateDocument(id, text string, a *logger.App) error {
+	cfg := config.NewConfig()
+	rate.LimitRequest(a)
+	url := fmt.Sprintf("%s/documents.update", cfg.BaseURL)
+
+	payloadBytes, err := json.Marshal(map[string]string{"id": id, "text": text})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to update document: %s", resp.Status)
+	}
+	return nil
+}
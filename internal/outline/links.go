@@ -0,0 +1,58 @@
+package outline
+
+import (
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/mmatongo/flowline/pkg/logger"
+)
+
+// pages link to each other through placeholders until every document exists and has a url.
+const pageLinkScheme = "flowline://page/"
+
+var pageLink = regexp.MustCompile(`\[([^\]]*)\]\(` + regexp.QuoteMeta(pageLinkScheme) + `([^)\s]+)\)`)
+
+// linkedDocument is a created document whose text still links to other pages.
+type linkedDocument struct {
+	id    string
+	title string
+	path  string
+	text  string
+}
+
+func placeholderLink(pageURL string) string {
+	return pageLinkScheme + url.PathEscape(pageURL)
+}
+
+// resolvePageLinks replaces the placeholders with the urls of the documents, links to pages
+// that were not migrated become plain text.
+func (m *migration) resolvePageLinks(a *logger.App) {
+	for _, document := range m.linked {
+		text := pageLink.ReplaceAllStringFunc(document.text, func(match string) string {
+			parts := pageLink.FindStringSubmatch(match)
+			pageURL, err := url.PathUnescape(parts[2])
+			if err != nil {
+				return parts[1]
+			}
+			if documentURL, ok := m.documentURLs[pageURL]; ok {
+				return "[" + parts[1] + "](" + documentURL + ")"
+			}
+			return parts[1]
+		})
+
+		if err := updateDocument(document.id, text, a); err != nil {
+			a.Logger.Errorf("failed to update the links of %s: %v", document.title, err)
+			continue
+		}
+		if err := os.WriteFile(document.path, []byte(text), 0644); err != nil {
+			a.Logger.Errorf("failed to write %s: %v", document.path, err)
+		}
+		a.Print("updated page links of: ", document.title)
+	}
+}
+
+func hasPageLinks(text string) bool {
+	return strings.Contains(text, pageLinkScheme)
+}
@@ -0,0 +1,148 @@
+package outline
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mmatongo/flowline/pkg/config"
+)
+
+// Manifest records everything a run created in Outline so that the run can be rolled back.
+type Manifest struct {
+	ID          string               `json:"id"`
+	StartedAt   time.Time            `json:"startedAt"`
+	OutputPath  string               `json:"outputPath"`
+	Collections []ManifestCollection `json:"collections"`
+	Documents   []ManifestDocument   `json:"documents"`
+	Attachments []ManifestAttachment `json:"attachments"`
+}
+
+type ManifestCollection struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type ManifestDocument struct {
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	ParentID string `json:"parentId,omitempty"`
+}
+
+type ManifestAttachment struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+func newManifest(outputPath string) *Manifest {
+	now := time.Now()
+	id := now.Format("20060102-150405")
+	for i := 2; ; i++ {
+		if _, err := os.Stat(manifestPath(id)); os.IsNotExist(err) {
+			break
+		}
+		id = fmt.Sprintf("%s-%d", now.Format("20060102-150405"), i)
+	}
+
+	// rollbacks may run from another directory
+	if abs, err := filepath.Abs(outputPath); err == nil {
+		outputPath = abs
+	}
+
+	return &Manifest{
+		ID:         id,
+		StartedAt:  now,
+		OutputPath: outputPath,
+	}
+}
+
+func manifestPath(runID string) string {
+	return filepath.Join(config.NewConfig().RunDir, runID+".json")
+}
+
+func loadManifest(runID string) (*Manifest, error) {
+	content, err := os.ReadFile(manifestPath(runID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest of run %s: %w", runID, err)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest of run %s: %w", runID, err)
+	}
+	return &manifest, nil
+}
+
+// save writes the manifest after every change so an interrupted run can still be rolled back.
+func (m *Manifest) save() error {
+	path := manifestPath(m.ID)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0644)
+}
+
+func (m *Manifest) addCollection(id, name string) error {
+	m.Collections = append(m.Collections, ManifestCollection{ID: id, Name: name})
+	return m.save()
+}
+
+func (m *Manifest) addDocument(id, title, parentID string) error {
+	m.Documents = append(m.Documents, ManifestDocument{ID: id, Title: title, ParentID: parentID})
+	return m.save()
+}
+
+func (m *Manifest) addAttachment(id, name, key string) error {
+	for _, attachment := range m.Attachments {
+		if attachment.ID == id {
+			return nil
+		}
+	}
+	m.Attachments = append(m.Attachments, ManifestAttachment{ID: id, Name: name, Key: key})
+	return m.save()
+}
+
+// sharedAttachments returns the ids of the attachments of the run that the manifests of other
+// runs reference as well, mapped to one of these runs.
+func (m *Manifest) sharedAttachments() (map[string]string, error) {
+	ids := make(map[string]bool)
+	for _, attachment := range m.Attachments {
+		ids[attachment.ID] = true
+	}
+
+	paths, err := filepath.Glob(manifestPath("*"))
+	if err != nil {
+		return nil, err
+	}
+
+	shared := make(map[string]string)
+	for _, path := range paths {
+		runID := strings.TrimSuffix(filepath.Base(path), ".json")
+		if runID == m.ID {
+			continue
+		}
+		other, err := loadManifest(runID)
+		if err != nil {
+			return nil, err
+		}
+		for _, attachment := range other.Attachments {
+			if ids[attachment.ID] {
+				shared[attachment.ID] = runID
+			}
+		}
+	}
+	return shared, nil
+}
+
+func (m *Manifest) empty() bool {
+	return len(m.Collections) == 0 && len(m.Documents) == 0 && len(m.Attachments) == 0
+}
@@ -0,0 +1,183 @@
+package outline
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mmatongo/flowline/pkg/config"
+	"github.com/mmatongo/flowline/pkg/logger"
+	"github.com/mmatongo/flowline/rate"
+)
+
+// Rollback deletes everything recorded in the manifest of a run. Documents are deleted in the
+// reverse order of their creation so children always go before their parents, collections go last.
+// Attachments that the documents of other runs use are kept.
+func Rollback(runID string, dryRun bool, a *logger.App) error {
+	manifest, err := loadManifest(runID)
+	if err != nil {
+		return err
+	}
+
+	shared, err := manifest.sharedAttachments()
+	if err != nil {
+		return fmt.Errorf("failed to read the manifests of other runs: %w", err)
+	}
+
+	if manifest.empty() {
+		a.Print("nothing to roll back for run ", runID)
+		return nil
+	}
+
+	fmt.Printf("run %s started at %s created:\n", manifest.ID, manifest.StartedAt.Format("2006-01-02 15:04:05"))
+	for i := len(manifest.Documents) - 1; i >= 0; i-- {
+		fmt.Printf("  document   %s (%s)\n", manifest.Documents[i].Title, manifest.Documents[i].ID)
+	}
+	for _, attachment := range manifest.Attachments {
+		if otherRun, ok := shared[attachment.ID]; ok {
+			fmt.Printf("  attachment %s (%s), kept as run %s uses it\n", attachment.Name, attachment.ID, otherRun)
+			continue
+		}
+		fmt.Printf("  attachment %s (%s)\n", attachment.Name, attachment.ID)
+	}
+	for _, collection := range manifest.Collections {
+		fmt.Printf("  collection %s (%s)\n", collection.Name, collection.ID)
+	}
+
+	if dryRun {
+		a.Print("dry run, nothing was deleted")
+		return nil
+	}
+
+	fmt.Printf("do you want to delete %d documents, %d attachments and %d collections? (y/n): ",
+		len(manifest.Documents), len(manifest.Attachments)-len(shared), len(manifest.Collections))
+	var userInput string
+	fmt.Scanln(&userInput)
+	if strings.ToLower(userInput) != "y" {
+		a.Print("rollback cancelled.")
+		return nil
+	}
+
+	var failed int
+	remaining := &Manifest{ID: manifest.ID, StartedAt: manifest.StartedAt, OutputPath: manifest.OutputPath}
+
+	for i := len(manifest.Documents) - 1; i >= 0; i-- {
+		document := manifest.Documents[i]
+		if err := deleteResource("documents.delete", document.ID, a); err != nil {
+			a.Logger.Errorf("failed to delete document %s: %v", document.Title, err)
+			remaining.Documents = append([]ManifestDocument{document}, remaining.Documents...)
+			failed++
+			continue
+		}
+		a.Print("deleted document: ", document.Title)
+	}
+
+	deleted := make(map[string]bool)
+	for _, attachment := range manifest.Attachments {
+		if _, ok := shared[attachment.ID]; ok {
+			continue
+		}
+		if err := deleteResource("attachments.delete", attachment.ID, a); err != nil {
+			a.Logger.Errorf("failed to delete attachment %s: %v", attachment.Name, err)
+			remaining.Attachments = append(remaining.Attachments, attachment)
+			failed++
+			continue
+		}
+		deleted[attachment.Key] = true
+		a.Print("deleted attachment: ", attachment.Name)
+	}
+
+	// later runs must not reuse the deleted attachments
+	var cacheErr error
+	if len(deleted) > 0 && manifest.OutputPath != "" {
+		cacheErr = forgetAttachments(manifest.OutputPath, deleted)
+		if cacheErr != nil {
+			a.Logger.Errorf("failed to update attachment cache: %v", cacheErr)
+		}
+	}
+
+	for _, collection := range manifest.Collections {
+		if err := deleteResource("collections.delete", collection.ID, a); err != nil {
+			a.Logger.Errorf("failed to delete collection %s: %v", collection.Name, err)
+			remaining.Collections = append(remaining.Collections, collection)
+			failed++
+			continue
+		}
+		a.Print("deleted collection: ", collection.Name)
+	}
+
+	if failed > 0 {
+		// keep what could not be deleted so the rollback can be retried
+		if err := remaining.save(); err != nil {
+			a.Logger.Errorf("failed to update manifest: %v", err)
+		}
+		return fmt.Errorf("%d items could not be deleted", failed)
+	}
+
+	if err := os.Remove(manifestPath(runID)); err != nil {
+		return err
+	}
+	if cacheErr != nil {
+		return fmt.Errorf("run %s was rolled back but resumed runs may link to its deleted attachments: %w", runID, cacheErr)
+	}
+
+	a.Print("run ", runID, " rolled back successfully")
+	return nil
+}
+
+// forgetAttachments drops the deleted attachments from the attachment cache of the output
+// directory of the run.
+func forgetAttachments(outputPath string, deleted map[string]bool) error {
+	path := filepath.Join(outputPath, attachmentCacheFile)
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("attachment cache %s not found: %w", path, err)
+	}
+
+	cache, err := loadAttachmentCache(outputPath)
+	if err != nil {
+		return err
+	}
+	return cache.forget(deleted)
+}
+
+func deleteResource(endpoint, id string, a *logger.App) error {
+	cfg := config.NewConfig()
+	rate.LimitRequest(a)
+	url := fmt.Sprintf("%s/%s", cfg.BaseURL, endpoint)
+
+	payloadBytes, err := json.Marshal(map[string]string{"id": id})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// already gone, i.e. deleted together with its parent
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s - %s", resp.Status, string(bodyBytes))
+	}
+	return nil
+}
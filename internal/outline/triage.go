@@ -0,0 +1,96 @@
+package outline
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mmatongo/flowline/internal/confluence"
+)
+
+const (
+	StaleArchive = "archive"
+	StaleSkip    = "skip"
+	StaleMark    = "mark"
+)
+
+type triageEntry struct {
+	Title        string
+	PageID       string
+	Source       string
+	LastModified time.Time
+	Stale        bool
+	Action       string
+	CollectionID string
+	DocumentID   string
+}
+
+// classify decides where a page goes based on its last modified date.
+func (m *migration) classify(page *confluence.Page, htmlContent string) triageEntry {
+	entry := triageEntry{
+		Title:        page.Title,
+		PageID:       page.ID,
+		Source:       page.URL,
+		Action:       "migrated",
+		CollectionID: m.CollectionID,
+	}
+
+	if m.StaleBefore.IsZero() {
+		return entry
+	}
+
+	modified, ok := confluence.LastModified(htmlContent)
+	if !ok {
+		return entry
+	}
+	entry.LastModified = modified
+
+	if !modified.Before(m.StaleBefore) {
+		return entry
+	}
+	entry.Stale = true
+
+	switch m.StaleAction {
+	case StaleSkip:
+		entry.Action = "skipped"
+		entry.CollectionID = ""
+	case StaleMark:
+		entry.Action = "marked"
+	default:
+		entry.Action = "archived"
+		entry.CollectionID = m.ArchiveCollectionID
+	}
+	return entry
+}
+
+func staleNotice(modified time.Time) string {
+	return fmt.Sprintf(":::warning\nThis page has not been updated since %s and may be out of date.\n:::\n\n", modified.Format("2006-01-02"))
+}
+
+func writeTriageReport(path string, entries []triageEntry) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	if err := w.Write([]string{"title", "page_id", "source", "last_modified", "stale", "action", "collection_id", "document_id"}); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		modified := ""
+		if !e.LastModified.IsZero() {
+			modified = e.LastModified.Format("2006-01-02")
+		}
+		record := []string{e.Title, e.PageID, e.Source, modified, fmt.Sprint(e.Stale), e.Action, e.CollectionID, e.DocumentID}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	return w.Error()
+}
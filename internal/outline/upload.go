@@ -1,10 +1,12 @@
 package outline
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/mmatongo/flowline/internal/confluence"
 	"github.com/mmatongo/flowline/pkg/logger"
@@ -12,13 +14,98 @@ import (
 	"golang.org/x/net/html"
 )
 
-func PrepareAndProcess(inputPath, outputPath, collectionID string, verify bool, a *logger.App) error {
-	if err := os.MkdirAll(outputPath, os.ModePerm); err != nil {
+// errDeclined is returned for documents the user chose not to upload with Verify.
+var errDeclined = errors.New("document declined")
+
+// Options configures an import into Outline.
+type Options struct {
+	InputPath  string
+	OutputPath string
+	Verify     bool
+	Filter     confluence.Filter
+
+	// CollectionID takes either the id or the name of an existing collection
+	CollectionID string
+
+	// CreateCollection creates the target collection from the space details instead,
+	// CollectionPerPage creates one collection for each top level page
+	CreateCollection  bool
+	CollectionPerPage bool
+	CollectionIcon    string
+	CollectionColor   string
+
+	Images  utils.ImageOptions
+	Convert utils.ConvertOptions
+	// UserMap is the csv mapping Confluence users to the email or name of Outline users
+	UserMap string
+
+	// attachments larger than MaxAttachmentSize are skipped, or with the link policy
+	// linked to where the export is hosted at AttachmentLinkBase
+	MaxAttachmentSize  int64
+	OversizePolicy     string
+	AttachmentLinkBase string
+
+	// pages last modified before StaleBefore are handled according to StaleAction,
+	// a zero StaleBefore disables triage
+	StaleBefore         time.Time
+	StaleAction         string
+	ArchiveCollectionID string
+}
+
+// migration holds the state of a single run.
+type migration struct {
+	Options
+	manifest    *Manifest
+	attachments *attachmentCache
+	triage      []triageEntry
+	// tree is the page tree the macros see, nodes maps each page to its node in it
+	tree  []*utils.PageNode
+	nodes map[*confluence.Page]*utils.PageNode
+	// exported is every page of the export, including the ones left out by the filter
+	exported []*confluence.Page
+	// documentURLs maps the url of each migrated page to its document
+	documentURLs map[string]string
+	linked       []linkedDocument
+	// root is a page uploaded without its children, which are uploaded next to it instead
+	root *confluence.Page
+
+	imageDir        string
+	imageBytesSaved int64
+}
+
+func PrepareAndProcess(opts Options, a *logger.App) error {
+	if err := os.MkdirAll(opts.OutputPath, os.ModePerm); err != nil {
 		a.Logger.Errorf("failed to create output directory: %v", err)
 		return err
 	}
 
-	htmlContent, err := os.ReadFile(filepath.Join(inputPath, "index.html"))
+	switch opts.OversizePolicy {
+	case "", OversizeSkip:
+	case OversizeLink:
+		if opts.AttachmentLinkBase == "" {
+			return fmt.Errorf("the link policy for oversized attachments requires an attachment link base")
+		}
+	default:
+		return fmt.Errorf("unknown oversize policy %q", opts.OversizePolicy)
+	}
+
+	if err := opts.Convert.Validate(); err != nil {
+		return err
+	}
+
+	if !opts.StaleBefore.IsZero() {
+		switch opts.StaleAction {
+		case StaleArchive:
+			if opts.ArchiveCollectionID == "" {
+				return fmt.Errorf("an archive collection is required to archive stale pages")
+			}
+		case StaleSkip, StaleMark:
+		default:
+			return fmt.Errorf("unknown stale action %q", opts.StaleAction)
+		}
+	}
+
+	htmlContent, err := os.ReadFile(filepath.Join(opts.InputPath, "index.html"))
 	if err != nil {
 		a.Logger.Errorf("failed to read index.html: %v", err)
 		return err
@@ -30,20 +117,164 @@ func PrepareAndProcess(inputPath, outputPath, collectionID string, verify bool,
 		return err
 	}
 
-	pages := confluence.ProcessHTML(doc)
-	return processPages(pages, inputPath, outputPath, collectionID, verify, a, "")
+	attachments, err := loadAttachmentCache(opts.OutputPath)
+	if err != nil {
+		a.Logger.Errorf("failed to load attachment cache: %v", err)
+		return err
+	}
+
+	m := &migration{Options: opts, manifest: newManifest(opts.OutputPath), attachments: attachments}
+	m.Convert.Report = &utils.Report{}
+
+	if opts.UserMap != "" {
+		mapping, err := utils.LoadUserMap(opts.UserMap)
+		if err != nil {
+			return err
+		}
+		if m.Convert.Users, err = resolveUsers(mapping, a); err != nil {
+			a.Logger.Errorf("failed to look up outline users: %v", err)
+			return err
+		}
+	}
+
+	m.exported = confluence.ProcessHTML(doc)
+	pages := opts.Filter.Apply(m.exported, opts.InputPath)
+	confluence.LoadProperties(pages, opts.InputPath)
+	m.nodes = make(map[*confluence.Page]*utils.PageNode)
+	m.tree = confluence.PageNodes(pages, m.nodes)
+	m.documentURLs = make(map[string]string)
+
+	a.Print("starting run ", m.manifest.ID)
+	defer func() {
+		if m.imageDir != "" {
+			os.RemoveAll(m.imageDir)
+			a.Print("image optimization saved ", utils.FormatSize(m.imageBytesSaved))
+		}
+		if m.Convert.Report.Len() > 0 {
+			reportPath := filepath.Join(opts.OutputPath, "report.csv")
+			if err := m.Convert.Report.Write(reportPath); err != nil {
+				a.Logger.Errorf("failed to write conversion report: %v", err)
+			} else {
+				a.Print(m.Convert.Report.Len(), " conversion issues written to: ", reportPath)
+			}
+		}
+		if !m.manifest.empty() {
+			a.Print("run ", m.manifest.ID, " can be undone with: flowline outline rollback --run ", m.manifest.ID)
+		}
+	}()
+
+	if opts.ArchiveCollectionID != "" {
+		if m.ArchiveCollectionID, err = ResolveCollection(opts.ArchiveCollectionID, a); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case opts.CollectionPerPage:
+		for _, page := range pages {
+			collection, err := createCollection(CollectionPayload{
+				Name:  page.Title,
+				Icon:  opts.CollectionIcon,
+				Color: opts.CollectionColor,
+			}, a)
+			if err != nil {
+				a.Logger.Errorf("failed to create collection for %s: %v", page.Title, err)
+				continue
+			}
+			m.record(m.manifest.addCollection(collection.ID, collection.Name), a)
+			m.CollectionID = collection.ID
+
+			// the page itself leads the collection and its children become top level documents
+			m.root = page
+			if err := processPages(append([]*confluence.Page{page}, page.Children...), m, a, map[string]string{}); err != nil {
+				return err
+			}
+		}
+	case opts.CreateCollection:
+		space := confluence.SpaceDetails(string(htmlContent))
+		collection, err := createCollection(CollectionPayload{
+			Name:        space.Name,
+			Description: space.Description,
+			Icon:        opts.CollectionIcon,
+			Color:       opts.CollectionColor,
+		}, a)
+		if err != nil {
+			a.Logger.Errorf("failed to create collection: %v", err)
+			return err
+		}
+		a.Logger.Printf("created collection %s with Id: %s", collection.Name, collection.ID)
+		m.record(m.manifest.addCollection(collection.ID, collection.Name), a)
+
+		m.CollectionID = collection.ID
+		if err := processPages(pages, m, a, map[string]string{}); err != nil {
+			return err
+		}
+	default:
+		if m.CollectionID, err = ResolveCollection(opts.CollectionID, a); err != nil {
+			return err
+		}
+		if err := processPages(pages, m, a, map[string]string{}); err != nil {
+			return err
+		}
+	}
+
+	m.resolvePageLinks(a)
+
+	if !opts.StaleBefore.IsZero() {
+		reportPath := filepath.Join(opts.OutputPath, "triage.csv")
+		if err := writeTriageReport(reportPath, m.triage); err != nil {
+			a.Logger.Errorf("failed to write triage report: %v", err)
+			return err
+		}
+		a.Print("triage report written to: ", reportPath)
+	}
+	return nil
 }
 
-func processPages(pages []*confluence.Page, inputPath, outputPath, collectionID string, verify bool, a *logger.App, parentID string) error {
+// processPages uploads the pages and their children, parents maps each collection to the
+// closest ancestor document created in it so that nesting survives pages being routed elsewhere.
+func processPages(pages []*confluence.Page, m *migration, a *logger.App, parents map[string]string) error {
 	for _, page := range pages {
-		documentID, err := processAndUploadFile(page.Title, filepath.Join(inputPath, page.URL), outputPath, collectionID, verify, a, parentID)
+		inputPath := filepath.Join(m.InputPath, page.URL)
+		children := parents
+
+		htmlContent, err := os.ReadFile(inputPath)
 		if err != nil {
 			a.Logger.Errorf("error processing file %s: %v", page.URL, err)
 			continue
 		}
 
-		if len(page.Children) > 0 {
-			err = processPages(page.Children, inputPath, outputPath, collectionID, verify, a, documentID)
+		entry := m.classify(page, string(htmlContent))
+		if entry.Action != "skipped" {
+			notice := ""
+			if entry.Action == "marked" {
+				notice = staleNotice(entry.LastModified)
+			}
+
+			documentID, err := processAndUploadFile(page, inputPath, string(htmlContent), notice, entry.CollectionID, parents[entry.CollectionID], m, a)
+			switch {
+			case errors.Is(err, errDeclined):
+				entry.Action = "skipped"
+			case err != nil:
+				a.Logger.Errorf("error processing file %s: %v", page.URL, err)
+				entry.Action = "failed"
+			}
+
+			entry.DocumentID = documentID
+			if documentID != "" {
+				children = make(map[string]string, len(parents)+1)
+				for collectionID, parentID := range parents {
+					children[collectionID] = parentID
+				}
+				children[entry.CollectionID] = documentID
+			}
+		} else {
+			a.Print("skipping stale page: ", page.Title)
+		}
+		m.triage = append(m.triage, entry)
+
+		if len(page.Children) > 0 && page != m.root {
+			err = processPages(page.Children, m, a, children)
 			if err != nil {
 				a.Logger.Errorf("error processing children of %s: %v", page.Title, err)
 			}
@@ -52,23 +283,32 @@ func processPages(pages []*confluence.Page, inputPath, outputPath, collectionID
 	return nil
 }
 
-func processAndUploadFile(title, inputPath, outputPath, collectionID string, verify bool, a *logger.App, parentID string) (string, error) {
-	htmlContent, err := os.ReadFile(inputPath)
+// record logs failures to persist the manifest, the run carries on since the next
+// save writes the whole manifest again.
+func (m *migration) record(err error, a *logger.App) {
 	if err != nil {
-		return "", err
+		a.Logger.Errorf("failed to save run manifest %s: %v", m.manifest.ID, err)
 	}
+}
 
-	processedHTML, err := uploadAndReplaceAttachments(string(htmlContent), filepath.Dir(inputPath), a)
+func processAndUploadFile(page *confluence.Page, inputPath, htmlContent, notice, collectionID, parentID string, m *migration, a *logger.App) (string, error) {
+	processedHTML, err := uploadAndReplaceAttachments(htmlContent, filepath.Dir(inputPath), page.ID, m, a)
 	if err != nil {
 		return "", err
 	}
 
-	_, markdownContent, err := utils.ConvertHTMLToMarkdown(processedHTML, a)
+	convert := m.Convert
+	convert.Target = utils.TargetOutline
+	convert.Page = m.nodes[page]
+	convert.Pages = m.tree
+	convert.PageLink = placeholderLink
+	_, markdownContent, err := utils.ConvertHTMLToMarkdown(processedHTML, convert, a)
 	if err != nil {
 		return "", err
 	}
+	markdownContent = notice + markdownContent
 
-	if verify {
+	if m.Verify {
 		a.Print("markdown content for: ", inputPath)
 		fmt.Println(strings.Repeat("=", 50))
 		fmt.Println(markdownContent)
@@ -79,11 +319,11 @@ func processAndUploadFile(title, inputPath, outputPath, collectionID string, ver
 		fmt.Scanln(&userInput)
 		if strings.ToLower(userInput) != "y" {
 			a.Print("skipping this document.")
-			return "", nil
+			return "", errDeclined
 		}
 	}
 
-	document, err := createDocument(title, markdownContent, collectionID, parentID, a)
+	document, err := createDocument(page.Title, markdownContent, collectionID, parentID, a)
 	if err != nil {
 		return "", err
 	}
@@ -92,14 +332,22 @@ func processAndUploadFile(title, inputPath, outputPath, collectionID string, ver
 	if !ok {
 		return "", fmt.Errorf("invalid document Id")
 	}
+	m.record(m.manifest.addDocument(documentID, page.Title, parentID), a)
+	if documentURL, ok := document["url"].(string); ok {
+		m.documentURLs[page.URL] = documentURL
+	}
 
-	a.Logger.Printf("successfully created document: %s with Id: %s", title, documentID)
+	a.Logger.Printf("successfully created document: %s with Id: %s", page.Title, documentID)
 
-	outputFilePath := filepath.Join(outputPath, strings.TrimSuffix(filepath.Base(inputPath), ".html")+".md")
+	outputFilePath := filepath.Join(m.OutputPath, strings.TrimSuffix(filepath.Base(inputPath), ".html")+".md")
 	if err := os.WriteFile(outputFilePath, []byte(markdownContent), 0644); err != nil {
 		return "", err
 	}
 
+	if hasPageLinks(markdownContent) {
+		m.linked = append(m.linked, linkedDocument{id: documentID, title: page.Title, path: outputFilePath, text: markdownContent})
+	}
+
 	a.Print("processed and uploaded: ", inputPath)
 	return documentID, nil
 }
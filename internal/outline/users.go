@@ -0,0 +1,110 @@
+package outline
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/mmatongo/flowline/pkg/config"
+	"github.com/mmatongo/flowline/pkg/logger"
+	"github.com/mmatongo/flowline/rate"
+	"github.com/mmatongo/flowline/utils"
+)
+
+const usersPageSize = 100
+
+// resolveUsers looks up the Outline users of a user map by email or name.
+func resolveUsers(mapping map[string]string, a *logger.App) (map[string]utils.User, error) {
+	users, err := listUsers(a)
+	if err != nil {
+		return nil, err
+	}
+
+	byEmailOrName := make(map[string]utils.User)
+	for _, user := range users {
+		if user.email != "" {
+			byEmailOrName[strings.ToLower(user.email)] = user.User
+		}
+		byEmailOrName[strings.ToLower(user.Name)] = user.User
+	}
+
+	resolved := make(map[string]utils.User)
+	for confluenceUser, outlineUser := range mapping {
+		user, ok := byEmailOrName[strings.ToLower(outlineUser)]
+		if !ok {
+			a.Logger.Errorf("outline user %s mapped from %s not found", outlineUser, confluenceUser)
+			continue
+		}
+		resolved[confluenceUser] = user
+	}
+	return resolved, nil
+}
+
+type outlineUser struct {
+	utils.User
+	email string
+}
+
+func listUsers(a *logger.App) ([]outlineUser, error) {
+	cfg := config.NewConfig()
+	url := fmt.Sprintf("%s/users.list", cfg.BaseURL)
+
+	var users []outlineUser
+	for offset := 0; ; offset += usersPageSize {
+		rate.LimitRequest(a)
+		payloadBytes, err := json.Marshal(map[string]int{"offset": offset, "limit": usersPageSize})
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequest("POST", url, bytes.NewBuffer(payloadBytes))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := cfg.Client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		bodyBytes, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading response body")
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("error status code %v", resp.StatusCode)
+		}
+
+		var result map[string]interface{}
+		if err := json.Unmarshal(bodyBytes, &result); err != nil {
+			return nil, fmt.Errorf("error unmarshalling json %w", err)
+		}
+
+		data, ok := result["data"].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("'data' field not found in response")
+		}
+
+		for _, item := range data {
+			if user, ok := item.(map[string]interface{}); ok {
+				id, _ := user["id"].(string)
+				name, _ := user["name"].(string)
+				email, _ := user["email"].(string)
+				users = append(users, outlineUser{User: utils.User{Name: name, ID: id}, email: email})
+			}
+		}
+
+		if len(data) < usersPageSize {
+			return users, nil
+		}
+	}
+}
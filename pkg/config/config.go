@@ -9,6 +9,7 @@ import (
 
 type Config struct {
 	LogDir  string
+	RunDir  string
 	BaseURL string
 	APIKey  string
 	Client  http.Client
@@ -17,6 +18,7 @@ type Config struct {
 func NewConfig() *Config {
 	c := &Config{
 		LogDir:  filepath.Join("/tmp/", time.Now().Local().Format("2006-01-02T15:04")+"-flowline.log"),
+		RunDir:  getEnv("RUN_DIR", defaultRunDir()),
 		BaseURL: getEnv("BASE_URL", ""),
 		APIKey:  getEnv("API_KEY", ""),
 		Client:  http.Client{},
@@ -31,3 +33,13 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// defaultRunDir is where run manifests are kept unless RUN_DIR is set, they have to outlive
+// the run so they are not written next to the log files.
+func defaultRunDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "flowline", "runs")
+	}
+	return filepath.Join(home, ".flowline", "runs")
+}
@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/JohannesKaufmann/html-to-markdown/escape"
+	"github.com/PuerkitoBio/goquery"
+)
+
+const anchorSelector = "span.confluence-anchor-link, [data-macro-name='anchor']"
+
+var (
+	headingMarker = regexp.MustCompile(`\s*FLOWLINEHEADING(\d+)END`)
+	headingLink   = regexp.MustCompile(`\[([^\]]*)\]\(#FLOWLINEHEADING(\d+)END((?:\s+"[^"]*")?)\)`)
+	headingAnchor = regexp.MustCompile(`#FLOWLINEHEADING(\d+)END`)
+)
+
+// convertAnchors keeps the targets of in-page links. Heading ids become the anchors of the
+// converted headings and anchor macros are kept as <a id> in markdown. Outline drops html so
+// links to anchor macros point at the heading of their section there instead.
+//
+// Headings are marked so that their anchors are computed once the macros in them are
+// converted, see resolveHeadings.
+func convertAnchors(content *goquery.Selection, opts ConvertOptions, blocks *macroBlocks) {
+	targets := make(map[string]string)
+	seen := make(map[string]int)
+	var section string
+
+	content.Find("h1, h2, h3, h4, h5, h6, " + anchorSelector).Each(func(i int, s *goquery.Selection) {
+		if s.Is("h1, h2, h3, h4, h5, h6") {
+			text := strings.Join(strings.Fields(s.Text()), " ")
+			marker := fmt.Sprintf("FLOWLINEHEADING%dEND", len(blocks.headings))
+			blocks.headings = append(blocks.headings, headingSlug(text, opts.Target, seen))
+			s.AppendHtml(" " + marker)
+			section = "#" + marker
+			if id := s.AttrOr("id", ""); id != "" {
+				targets[id] = section
+			}
+			s.Find(anchorSelector).Each(func(i int, anchor *goquery.Selection) {
+				if id := anchor.AttrOr("id", ""); id != "" {
+					targets[id] = section
+				}
+			})
+			return
+		}
+		if s.ParentsFiltered("h1, h2, h3, h4, h5, h6").Length() > 0 {
+			return
+		}
+
+		id := s.AttrOr("id", "")
+		if id == "" {
+			return
+		}
+		if opts.Target == TargetOutline {
+			if section != "" {
+				targets[id] = section
+			}
+			return
+		}
+		targets[id] = "#" + id
+	})
+
+	content.Find(anchorSelector).Each(func(i int, anchor *goquery.Selection) {
+		id := anchor.AttrOr("id", "")
+		if opts.Target == TargetOutline || id == "" || anchor.ParentsFiltered("h1, h2, h3, h4, h5, h6").Length() > 0 {
+			anchor.Remove()
+			return
+		}
+		blocks.inline(anchor, `<a id="`+html.EscapeString(id)+`"></a>`)
+	})
+
+	content.Find("a[href^='#']").Each(func(i int, link *goquery.Selection) {
+		id := strings.TrimPrefix(link.AttrOr("href", ""), "#")
+		if target, ok := targets[id]; ok {
+			link.SetAttr("href", target)
+		}
+	})
+}
+
+// resolveHeadings points the links to marked headings at the anchors of the converted headings
+// and removes the markers. Headings that are no longer headings, i.e. within a table, keep the
+// anchor computed from the page content.
+func (b *macroBlocks) resolveHeadings(markdown string) string {
+	if len(b.headings) == 0 {
+		return markdown
+	}
+
+	slugs := append([]string{}, b.headings...)
+	for _, h := range markdownHeadings(markdown, b.target) {
+		for _, marker := range h.markers {
+			if i, err := strconv.Atoi(headingMarker.FindStringSubmatch(marker)[1]); err == nil && i < len(slugs) {
+				slugs[i] = h.slug
+			}
+		}
+	}
+
+	markdown = headingLink.ReplaceAllStringFunc(markdown, func(link string) string {
+		match := headingLink.FindStringSubmatch(link)
+		i, _ := strconv.Atoi(match[2])
+		switch {
+		case i >= len(slugs):
+			return link
+		case slugs[i] == "":
+			// the anchor of the heading is not known, only the text of the link is kept
+			return match[1]
+		}
+		return "[" + match[1] + "](#" + slugs[i] + match[3] + ")"
+	})
+	// links headingLink does not match, i.e. around images
+	markdown = headingAnchor.ReplaceAllStringFunc(markdown, func(anchor string) string {
+		i, _ := strconv.Atoi(headingAnchor.FindStringSubmatch(anchor)[1])
+		if i >= len(slugs) {
+			return anchor
+		}
+		return "#" + slugs[i]
+	})
+	return headingMarker.ReplaceAllString(markdown, "")
+}
+
+const footnoteSelector = "[data-macro-name='footnote'], .footnote-macro"
+
+// convertFootnotes converts footnote macros into markdown footnotes. The definitions are put
+// where the page displays its footnotes, or at its end.
+func convertFootnotes(content *goquery.Selection, blocks *macroBlocks) {
+	var definitions []string
+	content.Find(footnoteSelector).Each(func(i int, footnote *goquery.Selection) {
+		text := strings.Join(strings.Fields(footnote.Text()), " ")
+		if text == "" {
+			return
+		}
+		label := strconv.Itoa(len(definitions) + 1)
+		definitions = append(definitions, "[^"+label+"]: "+escape.MarkdownCharacters(text))
+		blocks.inline(footnote, "[^"+label+"]")
+	})
+
+	if len(definitions) == 0 {
+		return
+	}
+
+	markdown := strings.Join(definitions, "\n")
+	if display := content.Find("[data-macro-name='display-footnotes'], .footnotes-macro").First(); display.Length() > 0 {
+		blocks.block(display, markdown)
+		return
+	}
+	content.AppendHtml("<p>" + blocks.token(markdown) + "</p>")
+}
@@ -0,0 +1,78 @@
+package utils
+
+import "testing"
+
+func TestResolveHeadings(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		headings []string
+		markdown string
+		want     string
+	}{
+		{
+			name:     "no headings",
+			target:   TargetMarkdown,
+			markdown: "[x](#top)",
+			want:     "[x](#top)",
+		},
+		{
+			name:     "anchor of the converted heading",
+			target:   TargetMarkdown,
+			headings: []string{"release-done"},
+			markdown: "[to](#FLOWLINEHEADING0END)\n\n## Release 🟢 **DONE** FLOWLINEHEADING0END",
+			want:     "[to](#release--done)\n\n## Release 🟢 **DONE**",
+		},
+		{
+			name:     "outline anchor",
+			target:   TargetOutline,
+			headings: []string{"h-owner"},
+			markdown: "## Owner @[John Smith](mention://1/user/2) FLOWLINEHEADING0END\n\n[owner](#FLOWLINEHEADING0END)",
+			want:     "## Owner @[John Smith](mention://1/user/2)\n\n[owner](#h-owner-john-smith)",
+		},
+		{
+			name:     "duplicate headings",
+			target:   TargetMarkdown,
+			headings: []string{"notes", "notes-1"},
+			markdown: "## Notes FLOWLINEHEADING0END\n\n## Notes FLOWLINEHEADING1END\n\n[second](#FLOWLINEHEADING1END)",
+			want:     "## Notes\n\n## Notes\n\n[second](#notes-1)",
+		},
+		{
+			name:     "heading within a table keeps the anchor of the page content",
+			target:   TargetMarkdown,
+			headings: []string{"in-cell"},
+			markdown: "| In cell FLOWLINEHEADING0END |\n| --- |\n\n[plain](#FLOWLINEHEADING0END)",
+			want:     "| In cell |\n| --- |\n\n[plain](#in-cell)",
+		},
+		{
+			name:     "unknown outline anchor keeps the link text",
+			target:   TargetOutline,
+			headings: []string{""},
+			markdown: "## Обзор FLOWLINEHEADING0END\n\nsee [overview](#FLOWLINEHEADING0END)",
+			want:     "## Обзор\n\nsee overview",
+		},
+		{
+			name:     "link title",
+			target:   TargetMarkdown,
+			headings: []string{"setup"},
+			markdown: "## Setup FLOWLINEHEADING0END\n\n[to](#FLOWLINEHEADING0END \"Setup\")",
+			want:     "## Setup\n\n[to](#setup \"Setup\")",
+		},
+		{
+			name:     "link around an image",
+			target:   TargetMarkdown,
+			headings: []string{"setup"},
+			markdown: "## Setup FLOWLINEHEADING0END\n\n[![](icon.png)](#FLOWLINEHEADING0END)",
+			want:     "## Setup\n\n[![](icon.png)](#setup)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &macroBlocks{target: tt.target, headings: tt.headings}
+			if got := b.resolveHeadings(tt.markdown); got != tt.want {
+				t.Errorf("resolveHeadings() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
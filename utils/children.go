@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/JohannesKaufmann/html-to-markdown/escape"
+	"github.com/PuerkitoBio/goquery"
+)
+
+// convertChildrenMacros regenerates the lists of the children display and page tree macros
+// from the page tree, linking to the migrated pages instead of the exported html files.
+func convertChildrenMacros(content *goquery.Selection, opts ConvertOptions, blocks *macroBlocks) {
+	if opts.Page == nil {
+		return
+	}
+
+	content.Find(".childpages-macro, [data-macro-name='children'], .plugin_pagetree, [data-macro-name='pagetree']").Each(func(i int, macro *goquery.Selection) {
+		tree := macro.Is(".plugin_pagetree, [data-macro-name='pagetree']")
+
+		var children []*PageNode
+		switch {
+		case tree:
+			// the page tree starts at the top of the space unless it names a root page
+			children = opts.Pages
+			if id := macro.Find("input[name='rootPageId']").AttrOr("value", ""); id != "" {
+				if root := findPage(opts.Pages, func(p *PageNode) bool { return p.ID == id }); root != nil {
+					children = root.Children
+				}
+			}
+		default:
+			children = opts.Page.Children
+			// the macro may list the children of another page
+			if href := macro.Find("a[href$='.html']").First().AttrOr("href", ""); href != "" {
+				if parent := findParent(opts.Pages, href); parent != nil {
+					children = parent.Children
+				}
+			}
+		}
+
+		depth := macroDepth(macro, tree)
+		var list strings.Builder
+		writePageList(&list, children, opts, depth, 0)
+
+		if list.Len() == 0 {
+			macro.Remove()
+			return
+		}
+		blocks.block(macro, strings.TrimSuffix(list.String(), "\n"))
+	})
+}
+
+// macroDepth returns how many levels of pages to list, 0 lists all of them. Without a depth
+// in the export the nesting of the exported list is used.
+func macroDepth(macro *goquery.Selection, tree bool) int {
+	for _, value := range []string{
+		macro.AttrOr("data-depth", ""),
+		macro.Find("input[name='startDepth']").AttrOr("value", ""),
+	} {
+		if depth, err := strconv.Atoi(value); err == nil && depth > 0 {
+			return depth
+		}
+	}
+
+	if macro.AttrOr("data-all", "") == "true" || tree {
+		return 0
+	}
+
+	depth := 0
+	macro.Find("li").Each(func(i int, li *goquery.Selection) {
+		depth = max(depth, li.ParentsUntilSelection(macro).Filter("li").Length()+1)
+	})
+	return max(depth, 1)
+}
+
+func writePageList(list *strings.Builder, pages []*PageNode, opts ConvertOptions, depth, level int) {
+	if depth > 0 && level >= depth {
+		return
+	}
+
+	for _, page := range pages {
+		title := escape.MarkdownCharacters(page.Title)
+		item := title
+		if opts.PageLink != nil {
+			if link := opts.PageLink(page.URL); link != "" {
+				item = "[" + title + "](" + link + ")"
+			}
+		}
+		list.WriteString(strings.Repeat("  ", level) + "- " + item + "\n")
+		writePageList(list, page.Children, opts, depth, level+1)
+	}
+}
@@ -12,7 +12,7 @@ import (
 	"github.com/mmatongo/flowline/pkg/logger"
 )
 
-func ConvertHTMLToMarkdown(htmlContent string, a *logger.App) (string, string, error) {
+func ConvertHTMLToMarkdown(htmlContent string, opts ConvertOptions, a *logger.App) (string, string, error) {
 	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
 	if err != nil {
 		a.Logger.Errorf("error creating a reader from the html content, %v", err)
@@ -30,6 +30,8 @@ func ConvertHTMLToMarkdown(htmlContent string, a *logger.App) (string, string, e
 		contentElement = doc.Find("body").First()
 	}
 
+	blocks := &macroBlocks{target: opts.Target}
+	preProcessMacros(contentElement, title, opts, blocks)
 	preProcessTables(contentElement)
 
 	// convert the extracted content to markdown
@@ -61,6 +63,10 @@ func ConvertHTMLToMarkdown(htmlContent string, a *logger.App) (string, string, e
 	}
 
 	markdown = postProcessMarkdown(markdown)
+	markdown = blocks.expand(markdown)
+	markdown = blocks.insertTOCs(markdown, opts)
+	markdown = blocks.resolveHeadings(markdown)
+	markdown = frontMatter(opts) + markdown
 
 	return title, markdown, nil
 }
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const ReportDroppedEmbed = "dropped embed"
+
+const embedSelector = "[data-macro-name='widget'], [data-macro-name='multimedia'], iframe, embed, object, video, audio"
+
+var (
+	youtubeEmbed = regexp.MustCompile(`^https?://(?:www\.)?youtube(?:-nocookie)?\.com/embed/([\w-]+)`)
+	vimeoEmbed   = regexp.MustCompile(`^https?://player\.vimeo\.com/video/(\d+)`)
+	loomEmbed    = regexp.MustCompile(`^https?://(?:www\.)?loom\.com/embed/(\w+)`)
+	driveEmbed   = regexp.MustCompile(`^(https?://drive\.google\.com/file/d/[\w-]+)/preview`)
+)
+
+// convertEmbeds converts widget connector, multimedia and iframe embeds into the url of what
+// they show. Outline embeds urls that are on a line of their own, markdown gets a link. Embeds
+// without a url are dropped and reported.
+func convertEmbeds(content *goquery.Selection, title string, opts ConvertOptions, blocks *macroBlocks) {
+	content.Find(embedSelector).Each(func(i int, embed *goquery.Selection) {
+		if embed.ParentsFiltered(embedSelector).Length() > 0 {
+			return
+		}
+
+		embedURL := embedSource(embed)
+		if embedURL == "" {
+			detail := embed.AttrOr("data-macro-name", goquery.NodeName(embed))
+			if src := embed.Find("iframe, embed, video, source").AddSelection(embed).AttrOr("src", ""); src != "" {
+				detail += " " + src
+			}
+			opts.Report.Add(title, ReportDroppedEmbed, detail)
+			embed.Remove()
+			return
+		}
+
+		if opts.Target == TargetOutline {
+			blocks.block(embed, embedURL)
+			return
+		}
+		blocks.block(embed, "["+embedURL+"]("+embedURL+")")
+	})
+}
+
+// embedSource returns the shareable url of an embed, player urls are turned back into the urls
+// of the video pages.
+func embedSource(embed *goquery.Selection) string {
+	candidates := []string{
+		embed.AttrOr("data-url", ""),
+		embed.AttrOr("src", ""),
+		embed.AttrOr("data", ""),
+	}
+	embed.Find("iframe, embed, video, source").Each(func(i int, s *goquery.Selection) {
+		candidates = append(candidates, s.AttrOr("src", ""))
+	})
+	embed.Find("a[href]").Each(func(i int, s *goquery.Selection) {
+		candidates = append(candidates, s.AttrOr("href", ""))
+	})
+
+	for _, candidate := range candidates {
+		candidate = strings.TrimSpace(candidate)
+		if strings.HasPrefix(candidate, "//") {
+			candidate = "https:" + candidate
+		}
+		parsed, err := url.Parse(candidate)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			continue
+		}
+
+		switch {
+		case youtubeEmbed.MatchString(candidate):
+			return "https://www.youtube.com/watch?v=" + youtubeEmbed.FindStringSubmatch(candidate)[1]
+		case vimeoEmbed.MatchString(candidate):
+			return "https://vimeo.com/" + vimeoEmbed.FindStringSubmatch(candidate)[1]
+		case loomEmbed.MatchString(candidate):
+			return "https://www.loom.com/share/" + loomEmbed.FindStringSubmatch(candidate)[1]
+		case driveEmbed.MatchString(candidate):
+			return driveEmbed.FindStringSubmatch(candidate)[1] + "/view"
+		}
+		return candidate
+	}
+	return ""
+}
@@ -0,0 +1,231 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"os"
+)
+
+// ImageOptions configures the optimization of png and jpeg attachments. Images are re-encoded
+// which drops any EXIF metadata, i.e. the GPS position of photos taken with a phone.
+type ImageOptions struct {
+	Enabled bool
+	// MaxDimension downscales images whose width or height is larger, 0 keeps the size
+	MaxDimension int
+	// Quality is the jpeg quality from 1 to 100
+	Quality int
+}
+
+// OptimizeImage writes an optimized version of the image at src to dst. The optimized version
+// is only written when it is smaller than the original or when the original carries metadata
+// that has to be stripped or it was resized, otherwise ok is false and dst is left untouched.
+func OptimizeImage(src, dst string, opts ImageOptions) (ok bool, saved int64, err error) {
+	if !opts.Enabled {
+		return false, 0, nil
+	}
+
+	mimeType := GetMimeType(src)
+	if mimeType != "image/png" && mimeType != "image/jpeg" {
+		return false, 0, nil
+	}
+
+	original, err := os.ReadFile(src)
+	if err != nil {
+		return false, 0, err
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(original))
+	if err != nil {
+		return false, 0, err
+	}
+
+	hasMetadata := false
+	if format == "jpeg" {
+		orientation, found := exifOrientation(original)
+		hasMetadata = found
+		img = orient(img, orientation)
+	} else {
+		hasMetadata = pngHasMetadata(original)
+	}
+
+	resized := false
+	if opts.MaxDimension > 0 {
+		bounds := img.Bounds()
+		if w, h := bounds.Dx(), bounds.Dy(); w > opts.MaxDimension || h > opts.MaxDimension {
+			if w >= h {
+				h = max(1, h*opts.MaxDimension/w)
+				w = opts.MaxDimension
+			} else {
+				w = max(1, w*opts.MaxDimension/h)
+				h = opts.MaxDimension
+			}
+			img = downscale(img, w, h)
+			resized = true
+		}
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg":
+		quality := opts.Quality
+		if quality <= 0 || quality > 100 {
+			quality = jpeg.DefaultQuality
+		}
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	default:
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, img)
+	}
+	if err != nil {
+		return false, 0, err
+	}
+
+	saved = int64(len(original) - buf.Len())
+	if saved <= 0 && !hasMetadata && !resized {
+		return false, 0, nil
+	}
+
+	if err := os.WriteFile(dst, buf.Bytes(), 0644); err != nil {
+		return false, 0, err
+	}
+	// stripping metadata or resizing may still grow the file, that is not a saving
+	return true, max(saved, 0), nil
+}
+
+// downscale resizes img to w x h by averaging the source pixels covered by each target pixel.
+func downscale(img image.Image, w, h int) image.Image {
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, max((y+1)*sh/h, y*sh/h+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, max((x+1)*sw/w, x*sw/w+1)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				offset := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint64(src.Pix[offset])
+					g += uint64(src.Pix[offset+1])
+					b += uint64(src.Pix[offset+2])
+					a += uint64(src.Pix[offset+3])
+					offset += 4
+					n++
+				}
+			}
+
+			offset := dst.PixOffset(x, y)
+			dst.Pix[offset] = uint8(r / n)
+			dst.Pix[offset+1] = uint8(g / n)
+			dst.Pix[offset+2] = uint8(b / n)
+			dst.Pix[offset+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// exifOrientation returns the orientation tag of the EXIF segment of a jpeg and whether the
+// image has an EXIF segment at all.
+func exifOrientation(data []byte) (int, bool) {
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xDA || i+2+length > len(data) {
+			break
+		}
+
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:]), true
+		}
+		i += 2 + length
+	}
+	return 1, false
+}
+
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder = binary.BigEndian
+	if string(tiff[:2]) == "II" {
+		order = binary.LittleEndian
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 1
+}
+
+// orient applies an EXIF orientation so the image still displays upright once the metadata is gone.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if orientation >= 5 {
+		w, h = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = w-1-y, x
+			case 7:
+				dx, dy = w-1-y, h-1-x
+			case 8:
+				dx, dy = y, h-1-x
+			}
+			dst.Set(dx, dy, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// pngHasMetadata reports whether a png carries text, time or EXIF chunks.
+func pngHasMetadata(data []byte) bool {
+	for i := 8; i+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		switch string(data[i+4 : i+8]) {
+		case "tEXt", "zTXt", "iTXt", "eXIf", "tIME":
+			return true
+		}
+		i += 12 + length
+	}
+	return false
+}
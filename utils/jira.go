@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/JohannesKaufmann/html-to-markdown/escape"
+	"github.com/PuerkitoBio/goquery"
+)
+
+var jiraKey = regexp.MustCompile(`^[A-Z][A-Z0-9_]+-\d+$`)
+
+// convertJiraMacros converts Jira filter macros into a link to the search followed by the
+// snapshot of the rows in the export, and single Jira issue macros into links to the issue.
+func convertJiraMacros(content *goquery.Selection, opts ConvertOptions, blocks *macroBlocks) {
+	content.Find(".jira-table, .static-jira-issues_count, [data-macro-name='jira']").Each(func(i int, macro *goquery.Selection) {
+		if macro.Is("[data-jira-key], .jira-issue") || macro.ParentsFiltered(".jira-table").Length() > 0 {
+			return
+		}
+
+		var link string
+		if searchURL, jql := jiraSearch(macro, opts); searchURL != "" {
+			text := "Jira issues"
+			if jql != "" {
+				text += ": " + jql
+			}
+			if macro.Is(".static-jira-issues_count") {
+				text = strings.TrimSpace(macro.Text())
+			}
+			link = "[" + tableCell(text) + "](" + searchURL + ")"
+		}
+
+		table := macro.Find("table").First()
+		switch {
+		case table.Length() > 0:
+			markdown := jiraTable(table, opts)
+			if link != "" {
+				markdown = link + "\n\n" + markdown
+			}
+			blocks.block(macro, markdown)
+		case link != "":
+			blocks.inline(macro, link)
+		}
+	})
+
+	content.Find("[data-jira-key], .jira-issue").Each(func(i int, macro *goquery.Selection) {
+		if macro.ParentsFiltered("[data-jira-key], .jira-issue").Length() > 0 {
+			return
+		}
+
+		key := strings.TrimSpace(macro.AttrOr("data-jira-key", ""))
+		anchor := macro.Find("a.jira-issue-key, a[href*='/browse/']").First()
+		if key == "" {
+			key = strings.TrimSpace(anchor.Text())
+		}
+		if !jiraKey.MatchString(key) {
+			return
+		}
+
+		markdown := key
+		if issueURL := jiraIssueURL(key, anchor.AttrOr("href", ""), opts); issueURL != "" {
+			markdown = "[" + key + "](" + issueURL + ")"
+		}
+		if summary := tableCell(macro.Find(".summary").First().Text()); summary != "" {
+			markdown += " - " + summary
+		}
+
+		blocks.inline(macro, markdown)
+	})
+}
+
+// jiraIssueURL links to the issue on the configured Jira instance, falling back to the link of
+// the export.
+func jiraIssueURL(key, href string, opts ConvertOptions) string {
+	if opts.JiraURL != "" {
+		return opts.JiraURL + "/browse/" + key
+	}
+	if strings.HasPrefix(href, "http://") || strings.HasPrefix(href, "https://") {
+		return href
+	}
+	return ""
+}
+
+// jiraSearch returns the url of the search behind a filter macro and its JQL.
+func jiraSearch(macro *goquery.Selection, opts ConvertOptions) (string, string) {
+	jql := macro.AttrOr("data-jql", "")
+	var href string
+
+	macro.Find("a[href*='jql=']").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		href = s.AttrOr("href", "")
+		if jql == "" {
+			if parsed, err := url.Parse(href); err == nil {
+				jql = parsed.Query().Get("jql")
+			}
+		}
+		return false
+	})
+
+	switch {
+	case opts.JiraURL != "" && jql != "":
+		return opts.JiraURL + "/issues/?jql=" + url.QueryEscape(jql), jql
+	case strings.HasPrefix(href, "http://") || strings.HasPrefix(href, "https://"):
+		return href, jql
+	}
+	return "", jql
+}
+
+// jiraTable renders the rows of a Jira filter macro as a markdown table with the issue keys
+// linked to their issues.
+func jiraTable(table *goquery.Selection, opts ConvertOptions) string {
+	var rows [][]string
+	table.Find("tr").Each(func(i int, tr *goquery.Selection) {
+		var row []string
+		tr.Find("th, td").Each(func(j int, cell *goquery.Selection) {
+			text := strings.Join(strings.Fields(cell.Text()), " ")
+			cellText := tableCell(text)
+			if jiraKey.MatchString(text) {
+				href := cell.Find("a").First().AttrOr("href", "")
+				if issueURL := jiraIssueURL(text, href, opts); issueURL != "" {
+					cellText = "[" + text + "](" + issueURL + ")"
+				}
+			}
+			row = append(row, cellText)
+		})
+		if len(row) > 0 {
+			rows = append(rows, row)
+		}
+	})
+
+	if len(rows) == 0 {
+		return ""
+	}
+
+	columns := 0
+	for _, row := range rows {
+		columns = max(columns, len(row))
+	}
+
+	var markdown strings.Builder
+	for i, row := range rows {
+		for j := 0; j < columns; j++ {
+			cell := ""
+			if j < len(row) {
+				cell = row[j]
+			}
+			markdown.WriteString("| " + cell + " ")
+		}
+		markdown.WriteString("|\n")
+		if i == 0 {
+			markdown.WriteString(strings.Repeat("| --- ", columns) + "|\n")
+		}
+	}
+	return strings.TrimSuffix(markdown.String(), "\n")
+}
+
+// tableCell escapes text so it can be written into a markdown table cell, line breaks are
+// collapsed and MarkdownCharacters escapes the pipes that would split the row.
+func tableCell(text string) string {
+	return escape.MarkdownCharacters(strings.Join(strings.Fields(text), " "))
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	layoutSelector  = ".contentLayout2, .contentLayout, .sectionColumnWrapper, [data-macro-name='section']"
+	sectionSelector = ".columnLayout, .sectionMacroRow"
+	cellSelector    = ".cell, .columnMacro"
+)
+
+// flattenLayouts converts page layouts and section macros into a linear reading order, each
+// column after the other. Sections can be separated by horizontal rules and, in markdown,
+// columns can be kept side by side in an html table.
+func flattenLayouts(content *goquery.Selection, opts ConvertOptions, blocks *macroBlocks) {
+	// innermost sections first so nested layouts are flattened before their parents
+	sections := content.Find(sectionSelector)
+	for i := sections.Length() - 1; i >= 0; i-- {
+		section := sections.Eq(i)
+
+		var cells []string
+		section.Find(cellSelector).Each(func(j int, cell *goquery.Selection) {
+			// cells of nested layouts are flattened with their own section
+			if cell.ParentsUntilSelection(section).Filter(sectionSelector).Length() > 0 {
+				return
+			}
+			inner := cell.Find(".innerCell").First()
+			if inner.Length() == 0 {
+				inner = cell
+			}
+			if html, err := inner.Html(); err == nil && strings.TrimSpace(html) != "" {
+				cells = append(cells, html)
+			}
+		})
+
+		if len(cells) > 1 && opts.LayoutTables && opts.Target == TargetMarkdown {
+			var table strings.Builder
+			for j, cell := range cells {
+				open := `</td>` + "\n" + `<td valign="top">`
+				if j == 0 {
+					open = "<table>\n<tr>\n" + `<td valign="top">`
+				}
+				table.WriteString("<p>" + blocks.token(open) + "</p>" + cell)
+			}
+			table.WriteString("<p>" + blocks.token("</td>\n</tr>\n</table>") + "</p>")
+			section.ReplaceWithHtml("<div>" + table.String() + "</div>")
+			continue
+		}
+
+		section.ReplaceWithHtml("<div>" + strings.Join(cells, "") + "</div>")
+	}
+
+	if !opts.LayoutRules {
+		return
+	}
+	content.Find(layoutSelector).Each(func(i int, layout *goquery.Selection) {
+		sections := layout.Children()
+		sections.Each(func(j int, section *goquery.Selection) {
+			if j < sections.Length()-1 {
+				section.AfterHtml("<hr/>")
+			}
+		})
+	})
+}
@@ -0,0 +1,309 @@
+package utils
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/JohannesKaufmann/html-to-markdown/escape"
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	TargetMarkdown = "markdown"
+	TargetOutline  = "outline"
+)
+
+// ConvertOptions configures how Confluence macros are converted for the target the markdown
+// is written for.
+type ConvertOptions struct {
+	// Target is TargetMarkdown or TargetOutline
+	Target string
+	// JiraURL is the base url jira issue and filter macros link to
+	JiraURL string
+	// Users maps lower case Confluence usernames, user keys and account ids to users
+	Users map[string]User
+	// StatusStyle renders status lozenges as StatusEmoji or StatusCode, StatusEmoji overrides
+	// the emoji of a lozenge colour, i.e. green, red, yellow, blue, purple or grey
+	StatusStyle string
+	StatusEmoji map[string]string
+	// TOC regenerates or drops table of contents macros, by default they are regenerated in
+	// markdown and dropped in Outline which has its own
+	TOC string
+	// Math converts math macros to MathTeX, or keeps their rendered image with MathImage
+	Math string
+	// LayoutRules separates the sections of page layouts with horizontal rules, LayoutTables
+	// keeps the columns side by side in an html table in markdown
+	LayoutRules  bool
+	LayoutTables bool
+	// EmbedPDFs embeds the pdfs of view file macros below their link in markdown
+	EmbedPDFs bool
+
+	// Page is the page being converted and Pages the tree of migrated pages, PageLink returns
+	// the link from the page being converted to the migrated page exported to pageURL
+	Page     *PageNode
+	Pages    []*PageNode
+	PageLink func(pageURL string) string
+
+	// Report collects what could not be converted, it is shared by all the pages of a run
+	Report *Report
+}
+
+// Validate checks the settings that come from the command line.
+func (o ConvertOptions) Validate() error {
+	switch o.StatusStyle {
+	case "", StatusEmoji, StatusCode:
+	default:
+		return fmt.Errorf("unknown status style %q", o.StatusStyle)
+	}
+
+	switch o.TOC {
+	case "", TOCRegenerate, TOCDrop:
+	default:
+		return fmt.Errorf("unknown toc mode %q", o.TOC)
+	}
+
+	switch o.Math {
+	case "", MathTeX, MathImage:
+	default:
+		return fmt.Errorf("unknown math mode %q", o.Math)
+	}
+
+	for color := range o.StatusEmoji {
+		if _, ok := defaultStatusEmoji[color]; !ok {
+			return fmt.Errorf("unknown status colour %q", color)
+		}
+	}
+	return nil
+}
+
+// macroBlocks holds the markdown of converted macros. Macros are replaced by tokens before the
+// html is sanitized and the tokens are expanded once the rest of the page is converted, so the
+// markdown is neither stripped by the sanitizer nor escaped by the converter.
+type macroBlocks struct {
+	target string
+	blocks []string
+	tocs   []tocMacro
+	// headings holds the anchors of the marked headings as computed from the page content
+	headings []string
+}
+
+var macroToken = regexp.MustCompile(`FLOWLINETOKEN(\d+)END`)
+
+func (b *macroBlocks) token(markdown string) string {
+	b.blocks = append(b.blocks, markdown)
+	return fmt.Sprintf("FLOWLINETOKEN%dEND", len(b.blocks)-1)
+}
+
+// block replaces s with a paragraph of its own holding the markdown. Within a table cell the
+// markdown is put on a single line instead so it does not break the row.
+func (b *macroBlocks) block(s *goquery.Selection, markdown string) {
+	if s.ParentsFiltered("td, th").Length() > 0 {
+		b.inline(s, b.cellLine(markdown))
+		return
+	}
+	s.ReplaceWithHtml("<p>" + b.token(markdown) + "</p>")
+}
+
+var (
+	tableRow       = regexp.MustCompile(`^\|.*\|$`)
+	tableSeparator = regexp.MustCompile(`^\|(\s*:?-+:?\s*\|)+$`)
+	cellSeparator  = regexp.MustCompile(` \| `)
+)
+
+// cellLine renders a markdown block on one line. Code lines become code spans, math becomes
+// inline math and tables are reduced to their cells. The lines are separated by <br> in
+// markdown, Outline does not keep html so they are separated by spaces there.
+func (b *macroBlocks) cellLine(markdown string) string {
+	var parts, math []string
+	var fence string
+	inMath := false
+
+	for _, line := range strings.Split(markdown, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			if trimmed == fence {
+				fence = ""
+			} else if strings.TrimSpace(line) != "" {
+				parts = append(parts, codeSpan(line))
+			}
+		case strings.HasPrefix(trimmed, "```"):
+			fence = trimmed[:len(trimmed)-len(strings.TrimLeft(trimmed, "`"))]
+		case trimmed == "$$":
+			if inMath && len(math) > 0 {
+				parts = append(parts, "$"+strings.ReplaceAll(strings.Join(math, " "), "|", `\|`)+"$")
+			}
+			inMath, math = !inMath, nil
+		case inMath:
+			math = append(math, trimmed)
+		case trimmed == "", tableSeparator.MatchString(trimmed),
+			strings.HasPrefix(trimmed, "<details"), strings.HasPrefix(trimmed, "</details"):
+		case strings.HasPrefix(trimmed, "<summary>"):
+			summary := strings.TrimSuffix(strings.TrimPrefix(trimmed, "<summary>"), "</summary>")
+			parts = append(parts, "*"+escape.MarkdownCharacters(html.UnescapeString(summary))+"*")
+		case tableRow.MatchString(trimmed):
+			cells := cellSeparator.Split(strings.TrimSpace(trimmed[1:len(trimmed)-1]), -1)
+			parts = append(parts, strings.Join(cells, ", "))
+		default:
+			parts = append(parts, trimmed)
+		}
+	}
+
+	if b.target == TargetOutline {
+		return strings.Join(parts, " ")
+	}
+	return strings.Join(parts, "<br>")
+}
+
+// codeSpan wraps a line of code in a code span, pipes are escaped as table cells require.
+func codeSpan(code string) string {
+	longest, run := 0, 0
+	for _, r := range code {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", longest+1)
+	if strings.HasPrefix(code, "`") || strings.HasSuffix(code, "`") {
+		code = " " + code + " "
+	}
+	return fence + strings.ReplaceAll(code, "|", `\|`) + fence
+}
+
+// inline replaces s with the markdown within the surrounding text.
+func (b *macroBlocks) inline(s *goquery.Selection, markdown string) {
+	s.ReplaceWithHtml(b.token(markdown))
+}
+
+func (b *macroBlocks) expand(markdown string) string {
+	return macroToken.ReplaceAllStringFunc(markdown, func(match string) string {
+		i, _ := strconv.Atoi(macroToken.FindStringSubmatch(match)[1])
+		if i >= len(b.blocks) {
+			return match
+		}
+		// blocks may hold the tokens of the macros nested in them
+		return b.expand(b.blocks[i])
+	})
+}
+
+// preProcessMacros converts the Confluence macros of the page content into markdown blocks.
+func preProcessMacros(content *goquery.Selection, title string, opts ConvertOptions, blocks *macroBlocks) {
+	flattenLayouts(content, opts, blocks)
+	convertAnchors(content, opts, blocks)
+	convertFootnotes(content, blocks)
+	convertEmbeds(content, title, opts, blocks)
+	convertViewFiles(content, opts, blocks)
+	convertTOCMacros(content, opts, blocks)
+	convertCodeMacros(content, opts, blocks)
+	convertJiraMacros(content, opts, blocks)
+	convertStatusMacros(content, opts, blocks)
+	convertChildrenMacros(content, opts, blocks)
+	convertPageProperties(content, opts, blocks)
+	convertMathMacros(content, opts, blocks)
+	// task lists convert the mentions of their assignees themselves
+	convertTaskLists(content, title, opts, blocks)
+	convertUserMentions(content, title, opts, blocks)
+}
+
+// codeLanguages maps the brushes of the Confluence code macro to fence identifiers.
+var codeLanguages = map[string]string{
+	"actionscript3": "actionscript",
+	"as3":           "actionscript",
+	"c#":            "csharp",
+	"c++":           "cpp",
+	"cf":            "coldfusion",
+	"cs":            "csharp",
+	"delphi":        "pascal",
+	"erl":           "erlang",
+	"golang":        "go",
+	"html/xml":      "xml",
+	"javafx":        "java",
+	"jfx":           "java",
+	"jscript":       "javascript",
+	"js":            "javascript",
+	"none":          "",
+	"patch":         "diff",
+	"pl":            "perl",
+	"plain":         "",
+	"ps":            "powershell",
+	"py":            "python",
+	"rb":            "ruby",
+	"sh":            "bash",
+	"shell":         "bash",
+	"text":          "",
+	"ts":            "typescript",
+	"vb":            "vbnet",
+	"yml":           "yaml",
+}
+
+// convertCodeMacros converts code macros into fenced code blocks. The brush of the macro is
+// stored in data-syntaxhighlighter-params, i.e. "brush: bash; gutter: false", the title is
+// kept as a caption and collapsed blocks are folded in markdown.
+func convertCodeMacros(content *goquery.Selection, opts ConvertOptions, blocks *macroBlocks) {
+	content.Find("[data-macro-name='code'], [data-macro-name='noformat'], div.code.panel").Each(func(i int, macro *goquery.Selection) {
+		pre := macro.Find("pre").First()
+		if pre.Length() == 0 {
+			return
+		}
+
+		params := parseSyntaxParams(pre.AttrOr("data-syntaxhighlighter-params", ""))
+		language := strings.ToLower(params["brush"])
+		if mapped, ok := codeLanguages[language]; ok {
+			language = mapped
+		}
+
+		code := strings.TrimRight(pre.Text(), "\n")
+		fence := "```"
+		for strings.Contains(code, fence) {
+			fence += "`"
+		}
+
+		info := language
+		// hugo style attributes, ignored by renderers that only read the language
+		if opts.Target == TargetMarkdown && params["gutter"] == "true" {
+			info += " {linenos=true"
+			if start, err := strconv.Atoi(params["first-line"]); err == nil && start > 1 {
+				info += fmt.Sprintf(",linenostart=%d", start)
+			}
+			info += "}"
+		}
+
+		codeBlock := fence + strings.TrimSpace(info) + "\n" + code + "\n" + fence
+		title := strings.TrimSpace(macro.Find(".codeHeader .code-title, .codeHeader b").First().Text())
+		collapsed := params["collapse"] == "true" || macro.Find(".collapse-source").Length() > 0
+
+		var markdown string
+		switch {
+		case collapsed && opts.Target == TargetMarkdown:
+			summary := title
+			if summary == "" {
+				summary = "Source"
+			}
+			markdown = "<details>\n<summary>" + html.EscapeString(summary) + "</summary>\n\n" + codeBlock + "\n\n</details>"
+		case title != "":
+			markdown = "*" + escape.MarkdownCharacters(title) + "*\n\n" + codeBlock
+		default:
+			markdown = codeBlock
+		}
+
+		blocks.block(macro, markdown)
+	})
+}
+
+func parseSyntaxParams(value string) map[string]string {
+	params := make(map[string]string)
+	for _, param := range strings.Split(value, ";") {
+		key, val, ok := strings.Cut(param, ":")
+		if !ok {
+			continue
+		}
+		params[strings.TrimSpace(key)] = strings.TrimSpace(val)
+	}
+	return params
+}
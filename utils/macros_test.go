@@ -0,0 +1,94 @@
+package utils
+
+import "testing"
+
+func TestCellLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		markdown string
+		want     string
+	}{
+		{
+			name:     "code",
+			target:   TargetMarkdown,
+			markdown: "```javascript\nvar a = 1;\n\nif (a || b) {}\n```",
+			want:     "`var a = 1;`<br>`if (a \\|\\| b) {}`",
+		},
+		{
+			name:     "code with backticks",
+			target:   TargetMarkdown,
+			markdown: "````\necho `date`\n````",
+			want:     "`` echo `date` ``",
+		},
+		{
+			name:     "code starting with a backtick",
+			target:   TargetMarkdown,
+			markdown: "```\n`x`\n```",
+			want:     "`` `x` ``",
+		},
+		{
+			name:     "caption and collapsed code",
+			target:   TargetMarkdown,
+			markdown: "<details>\n<summary>deploy &amp; run</summary>\n\n```bash\n./deploy\n```\n\n</details>",
+			want:     "*deploy & run*<br>`./deploy`",
+		},
+		{
+			name:     "math",
+			target:   TargetMarkdown,
+			markdown: "$$\n|x| +\ny\n$$",
+			want:     "$\\|x\\| + y$",
+		},
+		{
+			name:     "table",
+			target:   TargetMarkdown,
+			markdown: "| Key | Summary |\n| --- | --- |\n| [OPS-1](https://jira/browse/OPS-1) | A \\| B |",
+			want:     "Key, Summary<br>[OPS-1](https://jira/browse/OPS-1), A \\| B",
+		},
+		{
+			name:     "list",
+			target:   TargetMarkdown,
+			markdown: "- [x] done\n  - [ ] nested",
+			want:     "- [x] done<br>- [ ] nested",
+		},
+		{
+			name:     "outline separates lines with spaces",
+			target:   TargetOutline,
+			markdown: "- [Runbooks](flowline://page/1)\n  - [Deploy](flowline://page/2)",
+			want:     "- [Runbooks](flowline://page/1) - [Deploy](flowline://page/2)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &macroBlocks{target: tt.target}
+			if got := b.cellLine(tt.markdown); got != tt.want {
+				t.Errorf("cellLine() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMacroBlocksExpand(t *testing.T) {
+	b := &macroBlocks{}
+	inner := b.token("🟢 **DONE**")
+	outer := b.token("- [ ] ship " + inner)
+
+	tests := []struct {
+		name     string
+		markdown string
+		want     string
+	}{
+		{"block", "before\n\n" + outer + "\n\nafter", "before\n\n- [ ] ship 🟢 **DONE**\n\nafter"},
+		{"inline", "status " + inner, "status 🟢 **DONE**"},
+		{"unknown token", "FLOWLINETOKEN9END", "FLOWLINETOKEN9END"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := b.expand(tt.markdown); got != tt.want {
+				t.Errorf("expand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"mime"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	MathTeX   = "tex"
+	MathImage = "image"
+)
+
+const (
+	mathBlockSelector  = "[data-macro-name='mathblock'], [data-macro-name='mathjax-block-macro'], [data-macro-name='latex'], .mathjax-block, .latexmath-block, .math-block"
+	mathInlineSelector = "[data-macro-name='mathinline'], [data-macro-name='mathjax-inline-macro'], [data-macro-name='latex-inline'], .mathjax-inline, .latexmath-inline, .math-inline"
+)
+
+// convertMathMacros converts LaTeX and MathJax macros into $$...$$ blocks and inline $...$.
+// Macros exported as rendered images are only converted when the TeX is part of the export,
+// with MathImage the rendered images are kept whenever there is one.
+func convertMathMacros(content *goquery.Selection, opts ConvertOptions, blocks *macroBlocks) {
+	convert := func(macro *goquery.Selection, block bool) {
+		if macro.ParentsFiltered(mathBlockSelector+", "+mathInlineSelector).Length() > 0 {
+			return
+		}
+
+		image := macro.Filter("img").AddSelection(macro.Find("img"))
+		if opts.Math == MathImage && image.Length() > 0 {
+			return
+		}
+
+		tex := mathSource(macro, image)
+		if tex == "" {
+			return
+		}
+
+		if block {
+			blocks.block(macro, "$$\n"+tex+"\n$$")
+		} else {
+			blocks.inline(macro, "$"+tex+"$")
+		}
+	}
+
+	content.Find(mathBlockSelector).Each(func(i int, macro *goquery.Selection) { convert(macro, true) })
+	content.Find(mathInlineSelector).Each(func(i int, macro *goquery.Selection) { convert(macro, false) })
+}
+
+// mathSource returns the TeX of a math macro without its delimiters, from the text of the
+// macro or from the attributes of its rendered image.
+func mathSource(macro, image *goquery.Selection) string {
+	tex := ""
+	if image.Length() == 0 {
+		tex = macro.Text()
+	} else {
+		for _, attr := range []string{"data-macro-body", "data-tex", "alt", "title"} {
+			value := strings.TrimSpace(macro.AttrOr(attr, image.AttrOr(attr, "")))
+			// the alt text of an image is often just its file name
+			if value != "" && !strings.HasPrefix(mime.TypeByExtension(filepath.Ext(value)), "image/") {
+				tex = value
+				break
+			}
+		}
+	}
+
+	tex = strings.TrimSpace(tex)
+	for _, delimiters := range [][2]string{{`\[`, `\]`}, {`\(`, `\)`}, {"$$", "$$"}, {"$", "$"}} {
+		if len(tex) > len(delimiters[0])+len(delimiters[1]) && strings.HasPrefix(tex, delimiters[0]) && strings.HasSuffix(tex, delimiters[1]) {
+			tex = strings.TrimSpace(tex[len(delimiters[0]) : len(tex)-len(delimiters[1])])
+			break
+		}
+	}
+	return tex
+}
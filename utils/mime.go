@@ -0,0 +1,85 @@
+package utils
+
+const octetStream = "application/octet-stream"
+
+var mimeOverrides = map[string]string{}
+
+// knownMimeTypes covers office and diagram formats that are common in confluence exports but
+// are missing from most system mime tables.
+var knownMimeTypes = map[string]string{
+	".doc":     "application/msword",
+	".docx":    "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".dot":     "application/msword",
+	".dotx":    "application/vnd.openxmlformats-officedocument.wordprocessingml.template",
+	".xls":     "application/vnd.ms-excel",
+	".xlsx":    "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".xlsm":    "application/vnd.ms-excel.sheet.macroEnabled.12",
+	".ppt":     "application/vnd.ms-powerpoint",
+	".pptx":    "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".pps":     "application/vnd.ms-powerpoint",
+	".ppsx":    "application/vnd.openxmlformats-officedocument.presentationml.slideshow",
+	".odt":     "application/vnd.oasis.opendocument.text",
+	".ods":     "application/vnd.oasis.opendocument.spreadsheet",
+	".odp":     "application/vnd.oasis.opendocument.presentation",
+	".odg":     "application/vnd.oasis.opendocument.graphics",
+	".rtf":     "application/rtf",
+	".pdf":     "application/pdf",
+	".msg":     "application/vnd.ms-outlook",
+	".eml":     "message/rfc822",
+	".one":     "application/onenote",
+	".mpp":     "application/vnd.ms-project",
+	".vsd":     "application/vnd.visio",
+	".vsdx":    "application/vnd.ms-visio.drawing.main+xml",
+	".drawio":  "application/vnd.jgraph.mxfile",
+	".gliffy":  "application/gliffy+json",
+	".bpmn":    "application/bpmn+xml",
+	".puml":    "text/plain",
+	".svg":     "image/svg+xml",
+	".webp":    "image/webp",
+	".heic":    "image/heic",
+	".tif":     "image/tiff",
+	".tiff":    "image/tiff",
+	".psd":     "image/vnd.adobe.photoshop",
+	".ai":      "application/postscript",
+	".eps":     "application/postscript",
+	".mp4":     "video/mp4",
+	".mov":     "video/quicktime",
+	".webm":    "video/webm",
+	".avi":     "video/x-msvideo",
+	".wmv":     "video/x-ms-wmv",
+	".mp3":     "audio/mpeg",
+	".wav":     "audio/wav",
+	".m4a":     "audio/mp4",
+	".zip":     "application/zip",
+	".7z":      "application/x-7z-compressed",
+	".rar":     "application/vnd.rar",
+	".tar":     "application/x-tar",
+	".gz":      "application/gzip",
+	".tgz":     "application/gzip",
+	".json":    "application/json",
+	".xml":     "application/xml",
+	".yaml":    "application/yaml",
+	".yml":     "application/yaml",
+	".csv":     "text/csv",
+	".md":      "text/markdown",
+	".txt":     "text/plain",
+	".log":     "text/plain",
+	".sql":     "text/plain",
+	".sh":      "text/plain",
+	".ps1":     "text/plain",
+	".py":      "text/plain",
+	".har":     "application/json",
+	".pem":     "application/x-pem-file",
+	".crt":     "application/x-x509-ca-cert",
+	".ics":     "text/calendar",
+	".vcf":     "text/vcard",
+	".epub":    "application/epub+zip",
+	".jar":     "application/java-archive",
+	".war":     "application/java-archive",
+	".exe":     "application/vnd.microsoft.portable-executable",
+	".msi":     "application/x-msi",
+	".dmg":     "application/x-apple-diskimage",
+	".iso":     "application/x-iso9660-image",
+	".pages":   "application/vnd.apple.pages",
+	".numbers": "application/vnd.apple.numbers",
+}
@@ -0,0 +1,34 @@
+package utils
+
+// PageNode is a migrated page as seen by the macros that list pages or report their properties.
+type PageNode struct {
+	ID         string
+	Title      string
+	URL        string
+	Properties []Property
+	Children   []*PageNode
+}
+
+func findPage(pages []*PageNode, match func(*PageNode) bool) *PageNode {
+	for _, page := range pages {
+		if match(page) {
+			return page
+		}
+		if found := findPage(page.Children, match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// findParent returns the page whose children include the page exported to href.
+func findParent(pages []*PageNode, href string) *PageNode {
+	return findPage(pages, func(p *PageNode) bool {
+		for _, child := range p.Children {
+			if child.URL == href {
+				return true
+			}
+		}
+		return false
+	})
+}
@@ -0,0 +1,170 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/JohannesKaufmann/html-to-markdown/escape"
+	"github.com/PuerkitoBio/goquery"
+)
+
+// PropertiesSelector matches the page properties macros of a page.
+const PropertiesSelector = ".plugin-tabmeta-details, [data-macro-name='details']"
+
+// Property is a row of a page properties macro.
+type Property struct {
+	Key   string
+	Value string
+}
+
+const reportSelector = ".plugin-tabmeta-details-summary, .metadata-summary-macro, [data-macro-name='detailssummary']"
+
+// convertPageProperties regenerates page properties reports from the properties of the pages
+// below the converted page. In markdown the page properties themselves are lifted into the
+// front matter so their tables are removed.
+func convertPageProperties(content *goquery.Selection, opts ConvertOptions, blocks *macroBlocks) {
+	if opts.Page == nil {
+		return
+	}
+
+	content.Find(reportSelector).Each(func(i int, report *goquery.Selection) {
+		var rows []*PageNode
+		var collect func([]*PageNode)
+		collect = func(pages []*PageNode) {
+			for _, page := range pages {
+				if len(page.Properties) > 0 {
+					rows = append(rows, page)
+				}
+				collect(page.Children)
+			}
+		}
+		collect(opts.Page.Children)
+
+		// the report may be fed by pages elsewhere in the space, keep its snapshot then
+		if len(rows) == 0 {
+			return
+		}
+
+		// keep the columns of the exported report, the first one holds the titles
+		var columns []string
+		report.Find("tr").First().ChildrenFiltered("th, td").Each(func(j int, cell *goquery.Selection) {
+			if j > 0 {
+				columns = append(columns, strings.Join(strings.Fields(cell.Text()), " "))
+			}
+		})
+		if len(columns) == 0 {
+			seen := make(map[string]bool)
+			for _, page := range rows {
+				for _, property := range page.Properties {
+					if !seen[strings.ToLower(property.Key)] {
+						seen[strings.ToLower(property.Key)] = true
+						columns = append(columns, property.Key)
+					}
+				}
+			}
+		}
+
+		var table strings.Builder
+		table.WriteString("| Title |")
+		for _, column := range columns {
+			table.WriteString(" " + escape.MarkdownCharacters(column) + " |")
+		}
+		table.WriteString("\n" + strings.Repeat("| --- ", len(columns)+1) + "|\n")
+
+		for _, page := range rows {
+			title := escape.MarkdownCharacters(page.Title)
+			if opts.PageLink != nil {
+				if link := opts.PageLink(page.URL); link != "" {
+					title = "[" + title + "](" + link + ")"
+				}
+			}
+			table.WriteString("| " + title + " |")
+			for _, column := range columns {
+				table.WriteString(" " + escape.MarkdownCharacters(propertyValue(page.Properties, column)) + " |")
+			}
+			table.WriteString("\n")
+		}
+
+		blocks.block(report, strings.TrimSuffix(table.String(), "\n"))
+	})
+
+	if opts.Target == TargetMarkdown && len(opts.Page.Properties) > 0 {
+		content.Find(PropertiesSelector).Remove()
+	}
+}
+
+func propertyValue(properties []Property, key string) string {
+	for _, property := range properties {
+		if strings.EqualFold(property.Key, key) {
+			return property.Value
+		}
+	}
+	return ""
+}
+
+// frontMatter returns the page properties of the converted page as yaml front matter.
+func frontMatter(opts ConvertOptions) string {
+	if opts.Target != TargetMarkdown || opts.Page == nil || len(opts.Page.Properties) == 0 {
+		return ""
+	}
+
+	var fields strings.Builder
+	seen := make(map[string]bool)
+	for _, property := range opts.Page.Properties {
+		key := frontMatterKey(property.Key)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		fields.WriteString(key + ": " + yamlQuote(property.Value) + "\n")
+	}
+
+	if fields.Len() == 0 {
+		return ""
+	}
+	return "---\n" + fields.String() + "---\n\n"
+}
+
+// yamlEscapes are the short escapes of yaml double quoted scalars.
+var yamlEscapes = map[rune]string{
+	0x00: `\0`, 0x07: `\a`, 0x08: `\b`, 0x09: `\t`, 0x0a: `\n`, 0x0b: `\v`, 0x0c: `\f`,
+	0x0d: `\r`, 0x1b: `\e`, '"': `\"`, '\\': `\\`, 0x85: `\N`, 0x2028: `\L`, 0x2029: `\P`,
+}
+
+// yamlQuote returns value as a yaml double quoted scalar. Characters yaml does not allow
+// unescaped are written as \u escapes, invalid utf-8 becomes the replacement character.
+func yamlQuote(value string) string {
+	var quoted strings.Builder
+	quoted.WriteByte('"')
+	for _, r := range value {
+		switch {
+		case yamlEscapes[r] != "":
+			quoted.WriteString(yamlEscapes[r])
+		case r < 0x20 || (r >= 0x7f && r <= 0x9f) || r == 0xfeff || r == 0xfffe || r == 0xffff:
+			fmt.Fprintf(&quoted, `\u%04x`, r)
+		default:
+			quoted.WriteRune(r)
+		}
+	}
+	quoted.WriteByte('"')
+	return quoted.String()
+}
+
+// frontMatterKey turns a property name into a snake case key, i.e. "Due date" into due_date.
+func frontMatterKey(name string) string {
+	var key strings.Builder
+	underscore := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if underscore && key.Len() > 0 {
+				key.WriteRune('_')
+			}
+			key.WriteRune(r)
+			underscore = false
+		} else {
+			underscore = true
+		}
+	}
+	return key.String()
+}
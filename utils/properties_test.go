@@ -0,0 +1,28 @@
+package utils
+
+import "testing"
+
+func TestYamlQuote(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"plain", "2024-05-01", `"2024-05-01"`},
+		{"quotes and backslashes", `say "hi" C:\tmp`, `"say \"hi\" C:\\tmp"`},
+		{"line breaks and tabs", "a\nb\r\tc", `"a\nb\r\tc"`},
+		{"control characters", "\x01\x1b\x7f", `"\u0001\e\u007f"`},
+		{"unicode line breaks", "a\u0085b\u2028c\u2029", `"a\Nb\Lc\P"`},
+		{"byte order mark", "\ufeffdone", `"\ufeffdone"`},
+		{"invalid utf-8", "a\xffb", "\"a\uFFFDb\""},
+		{"printable unicode", "Übersicht\u00a0🟢", "\"Übersicht\u00a0🟢\""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := yamlQuote(tt.value); got != tt.want {
+				t.Errorf("yamlQuote(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
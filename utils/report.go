@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"encoding/csv"
+	"os"
+)
+
+const ReportUnmappedUser = "unmapped user"
+
+// Report collects the content that could not be converted faithfully during a run.
+type Report struct {
+	entries []ReportEntry
+	seen    map[ReportEntry]bool
+}
+
+type ReportEntry struct {
+	Page   string
+	Kind   string
+	Detail string
+}
+
+func (r *Report) Add(page, kind, detail string) {
+	if r == nil {
+		return
+	}
+
+	entry := ReportEntry{Page: page, Kind: kind, Detail: detail}
+	if r.seen == nil {
+		r.seen = make(map[ReportEntry]bool)
+	}
+	if r.seen[entry] {
+		return
+	}
+	r.seen[entry] = true
+	r.entries = append(r.entries, entry)
+}
+
+func (r *Report) Len() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.entries)
+}
+
+// Write writes the entries to a csv file.
+func (r *Report) Write(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	if err := w.Write([]string{"page", "kind", "detail"}); err != nil {
+		return err
+	}
+
+	for _, e := range r.entries {
+		if err := w.Write([]string{e.Page, e.Kind, e.Detail}); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"strings"
+
+	"github.com/JohannesKaufmann/html-to-markdown/escape"
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	StatusEmoji = "emoji"
+	StatusCode  = "code"
+)
+
+// statusColors maps the lozenge classes of the status macro to the colour picked in Confluence.
+var statusColors = map[string]string{
+	"aui-lozenge-success":  "green",
+	"aui-lozenge-error":    "red",
+	"aui-lozenge-current":  "yellow",
+	"aui-lozenge-complete": "blue",
+	"aui-lozenge-moved":    "purple",
+}
+
+var defaultStatusEmoji = map[string]string{
+	"grey":   "⚪",
+	"red":    "🔴",
+	"yellow": "🟡",
+	"green":  "🟢",
+	"blue":   "🔵",
+	"purple": "🟣",
+}
+
+// convertStatusMacros converts status lozenges into an emoji of their colour followed by the
+// bold status, or into inline code.
+func convertStatusMacros(content *goquery.Selection, opts ConvertOptions, blocks *macroBlocks) {
+	content.Find(".status-macro, [data-macro-name='status']").Each(func(i int, macro *goquery.Selection) {
+		status := strings.Join(strings.Fields(macro.Text()), " ")
+		if status == "" {
+			return
+		}
+
+		if opts.StatusStyle == StatusCode {
+			blocks.inline(macro, "`"+strings.ReplaceAll(status, "`", "'")+"`")
+			return
+		}
+
+		color := "grey"
+		for class, c := range statusColors {
+			if macro.HasClass(class) {
+				color = c
+				break
+			}
+		}
+
+		emoji, ok := opts.StatusEmoji[color]
+		if !ok {
+			emoji = defaultStatusEmoji[color]
+		}
+
+		markdown := "**" + escape.MarkdownCharacters(status) + "**"
+		if emoji != "" {
+			markdown = emoji + " " + markdown
+		}
+		blocks.inline(macro, markdown)
+	})
+}
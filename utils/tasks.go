@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"strings"
+
+	md "github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/PuerkitoBio/goquery"
+)
+
+const taskListSelector = "ul.inline-task-list, ul[data-inline-tasks-content-id]"
+
+// convertTaskLists converts Confluence inline task lists, including nested ones, into
+// checklists with the assignee and the due date of each task after its text, i.e.
+// "- [x] text (@user, due 2024-05-01)".
+func convertTaskLists(content *goquery.Selection, title string, opts ConvertOptions, blocks *macroBlocks) {
+	converter := md.NewConverter("", true, nil)
+
+	content.Find(taskListSelector).Each(func(i int, list *goquery.Selection) {
+		if list.ParentsFiltered(taskListSelector).Length() > 0 {
+			return
+		}
+
+		var markdown strings.Builder
+		writeTasks(&markdown, list, 0, title, opts, converter)
+		if markdown.Len() == 0 {
+			return
+		}
+		blocks.block(list, strings.TrimSuffix(markdown.String(), "\n"))
+	})
+}
+
+func writeTasks(markdown *strings.Builder, list *goquery.Selection, level int, title string, opts ConvertOptions, converter *md.Converter) {
+	list.ChildrenFiltered("li").Each(func(i int, task *goquery.Selection) {
+		nested := task.ChildrenFiltered(taskListSelector).Remove()
+		task.Find(taskListSelector).Remove()
+
+		var details []string
+		task.Find(userLinkSelector).Each(func(i int, link *goquery.Selection) {
+			if mention, ok := userMention(link, title, opts); ok {
+				details = append(details, mention)
+			}
+			link.Remove()
+		})
+		task.Find("time[datetime]").Each(func(i int, date *goquery.Selection) {
+			details = append(details, "due "+date.AttrOr("datetime", ""))
+			date.Remove()
+		})
+
+		text := strings.Join(strings.Fields(converter.Convert(task)), " ")
+		if len(details) > 0 {
+			text = strings.TrimSpace(text + " (" + strings.Join(details, ", ") + ")")
+		}
+
+		checkbox := "[ ]"
+		if task.HasClass("checked") || task.AttrOr("data-inline-task-status", "") == "complete" {
+			checkbox = "[x]"
+		}
+		markdown.WriteString(strings.Repeat("  ", level) + "- " + checkbox + " " + text + "\n")
+
+		nested.Each(func(i int, list *goquery.Selection) {
+			writeTasks(markdown, list, level+1, title, opts, converter)
+		})
+	})
+}
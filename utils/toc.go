@@ -0,0 +1,231 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	TOCRegenerate = "regenerate"
+	TOCDrop       = "drop"
+)
+
+type tocMacro struct {
+	token  string
+	levels map[int]bool
+	// cell is set for tables of contents within a table cell, they are kept on one line
+	cell bool
+}
+
+var (
+	headingLine  = regexp.MustCompile(`^(#{1,6})\s+(.*?)(?:\s+#+)?\s*$`)
+	markdownLink = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+)
+
+// convertTOCMacros replaces table of contents macros by a token that is filled in once the
+// headings are converted, or removes them. Outline shows its own table of contents so the
+// macros are dropped there unless asked otherwise.
+func convertTOCMacros(content *goquery.Selection, opts ConvertOptions, blocks *macroBlocks) {
+	mode := opts.TOC
+	if mode == "" {
+		mode = TOCRegenerate
+		if opts.Target == TargetOutline {
+			mode = TOCDrop
+		}
+	}
+
+	content.Find(".toc-macro, [data-macro-name='toc']").Each(func(i int, macro *goquery.Selection) {
+		if macro.ParentsFiltered(".toc-macro, [data-macro-name='toc']").Length() > 0 {
+			return
+		}
+		if mode == TOCDrop {
+			macro.Remove()
+			return
+		}
+
+		toc := tocMacro{
+			token: fmt.Sprintf("FLOWLINETOC%dEND", len(blocks.tocs)),
+			cell:  macro.ParentsFiltered("td, th").Length() > 0,
+		}
+		if elements, ok := macro.Attr("data-headerelements"); ok {
+			toc.levels = make(map[int]bool)
+			for _, element := range strings.Split(elements, ",") {
+				if level, err := strconv.Atoi(strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(element)), "H")); err == nil {
+					toc.levels[level] = true
+				}
+			}
+		}
+		blocks.tocs = append(blocks.tocs, toc)
+		if toc.cell {
+			macro.ReplaceWithHtml(toc.token)
+			return
+		}
+		macro.ReplaceWithHtml("<p>" + toc.token + "</p>")
+	})
+}
+
+type heading struct {
+	level int
+	text  string
+	slug  string
+	// markers are the heading markers of convertAnchors found in the heading
+	markers []string
+}
+
+// insertTOCs generates the table of contents of each toc token from the markdown headings.
+func (b *macroBlocks) insertTOCs(markdown string, opts ConvertOptions) string {
+	if len(b.tocs) == 0 {
+		return markdown
+	}
+
+	headings := markdownHeadings(markdown, opts.Target)
+	for _, toc := range b.tocs {
+		var entries []heading
+		minLevel := 7
+		for _, h := range headings {
+			if toc.levels != nil && !toc.levels[h.level] {
+				continue
+			}
+			entries = append(entries, h)
+			minLevel = min(minLevel, h.level)
+		}
+
+		var list strings.Builder
+		for _, h := range entries {
+			entry := "[" + h.text + "](#" + h.slug + ")"
+			if h.slug == "" {
+				entry = h.text
+			}
+			list.WriteString(strings.Repeat("  ", h.level-minLevel) + "- " + entry + "\n")
+		}
+		entriesMarkdown := strings.TrimSuffix(list.String(), "\n")
+		if toc.cell {
+			entriesMarkdown = b.cellLine(entriesMarkdown)
+		}
+		markdown = strings.Replace(markdown, toc.token, entriesMarkdown, 1)
+	}
+	return markdown
+}
+
+// markdownHeadings lists the atx headings outside of code blocks with their anchors.
+func markdownHeadings(markdown, target string) []heading {
+	var headings []heading
+	seen := make(map[string]int)
+	fence := ""
+
+	for _, line := range strings.Split(markdown, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+
+		match := headingLine.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		markers := headingMarker.FindAllString(match[2], -1)
+		text := strings.TrimSpace(headingMarker.ReplaceAllString(match[2], ""))
+		headings = append(headings, heading{
+			level:   len(match[1]),
+			text:    markdownLink.ReplaceAllString(text, "$1"),
+			slug:    headingSlug(plainText(text), target, seen),
+			markers: markers,
+		})
+	}
+	return headings
+}
+
+// plainText strips links, emphasis and escapes from inline markdown.
+func plainText(markdown string) string {
+	var text strings.Builder
+	escaped := false
+	for _, r := range markdownLink.ReplaceAllString(markdown, "$1") {
+		switch {
+		case escaped:
+			text.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case strings.ContainsRune("*_`~", r):
+		default:
+			text.WriteRune(r)
+		}
+	}
+	return text.String()
+}
+
+// asciiLetters maps the accented latin letters to the ascii letters Outline uses for them in its
+// anchors, i.e. "Übersicht" becomes h-ubersicht.
+var asciiLetters = func() map[rune]string {
+	letters := make(map[rune]string)
+	for accented, ascii := range map[string]string{
+		"àáâãäåāăą": "a", "æ": "ae", "çćĉċč": "c", "ðďđ": "d", "èéêëēĕėęě": "e", "ĝğġģ": "g",
+		"ĥħ": "h", "ìíîïĩīĭįı": "i", "ĳ": "ij", "ĵ": "j", "ķĸ": "k", "ĺļľŀł": "l", "ñńņňŉŋ": "n",
+		"òóôõöøōŏő": "o", "œ": "oe", "ŕŗř": "r", "śŝşšſ": "s", "ß": "ss", "ţťŧ": "t", "þ": "th",
+		"ùúûüũūŭůűų": "u", "ŵ": "w", "ýÿŷ": "y", "źżž": "z",
+	} {
+		for _, r := range accented {
+			letters[r] = ascii
+		}
+	}
+	return letters
+}()
+
+// headingSlug returns the anchor of a heading, GitHub style for markdown and the h- prefixed
+// anchors of Outline. seen counts the slugs of the page so far to number duplicates. Outline
+// anchors of headings with letters that have no ascii equivalent here are not known, the slug
+// is empty then.
+func headingSlug(text, target string, seen map[string]int) string {
+	var slug strings.Builder
+	if target == TargetOutline {
+		// outline joins the ascii words with single dashes and drops everything else
+		slug.WriteString("h-")
+		dash := false
+		for _, r := range strings.ToLower(text) {
+			letters := string(r)
+			if ascii, ok := asciiLetters[r]; ok {
+				letters = ascii
+			} else if r > unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+				return ""
+			}
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				if dash && slug.Len() > 2 {
+					slug.WriteRune('-')
+				}
+				slug.WriteString(letters)
+				dash = false
+			} else {
+				dash = true
+			}
+		}
+	} else {
+		for _, r := range strings.ToLower(strings.TrimSpace(text)) {
+			switch {
+			case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_':
+				slug.WriteRune(r)
+			case r == ' ':
+				slug.WriteRune('-')
+			}
+		}
+	}
+
+	base := slug.String()
+	n := seen[base]
+	seen[base] = n + 1
+	if n > 0 {
+		return fmt.Sprintf("%s-%d", base, n)
+	}
+	return base
+}
@@ -0,0 +1,35 @@
+package utils
+
+import "testing"
+
+func TestHeadingSlug(t *testing.T) {
+	tests := []struct {
+		name   string
+		texts  []string
+		target string
+		want   []string
+	}{
+		{"github words", []string{"Setup & Install"}, TargetMarkdown, []string{"setup--install"}},
+		{"github keeps dashes and underscores", []string{"run_all - now"}, TargetMarkdown, []string{"run_all---now"}},
+		{"github keeps unicode", []string{"Übersicht"}, TargetMarkdown, []string{"übersicht"}},
+		{"github drops emoji", []string{"Release 🟢 DONE"}, TargetMarkdown, []string{"release--done"}},
+		{"github numbers duplicates", []string{"Notes", "Notes", "Notes"}, TargetMarkdown, []string{"notes", "notes-1", "notes-2"}},
+		{"outline words", []string{"Setup & Install"}, TargetOutline, []string{"h-setup-install"}},
+		{"outline trims separators", []string{"  (Setup)  "}, TargetOutline, []string{"h-setup"}},
+		{"outline transliterates", []string{"Übersicht", "Straße", "Œuvre çà"}, TargetOutline, []string{"h-ubersicht", "h-strasse", "h-oeuvre-ca"}},
+		{"outline drops emoji", []string{"Release 🟢 DONE"}, TargetOutline, []string{"h-release-done"}},
+		{"outline unknown script", []string{"Обзор"}, TargetOutline, []string{""}},
+		{"outline numbers duplicates", []string{"Notes", "notes"}, TargetOutline, []string{"h-notes", "h-notes-1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen := make(map[string]int)
+			for i, text := range tt.texts {
+				if got := headingSlug(text, tt.target, seen); got != tt.want[i] {
+					t.Errorf("headingSlug(%q, %q) = %q, want %q", text, tt.target, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/csv"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/JohannesKaufmann/html-to-markdown/escape"
+	"github.com/PuerkitoBio/goquery"
+)
+
+// User is the user a Confluence user is mentioned as, ID is only known for Outline users.
+type User struct {
+	Name string
+	ID   string
+}
+
+// LoadUserMap reads a csv mapping Confluence usernames, user keys or account ids to the email
+// or name of the user in the target. A header row starting with "confluence" is skipped.
+func LoadUserMap(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	r.Comment = '#'
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read user map %s: %w", path, err)
+	}
+
+	mapping := make(map[string]string)
+	for i, record := range records {
+		if len(record) < 2 {
+			continue
+		}
+		if i == 0 && strings.EqualFold(record[0], "confluence") {
+			continue
+		}
+		from, to := strings.ToLower(strings.TrimSpace(record[0])), strings.TrimSpace(record[1])
+		if from != "" && to != "" {
+			mapping[from] = to
+		}
+	}
+	return mapping, nil
+}
+
+const userLinkSelector = "a.confluence-userlink, a.user-mention, a[data-username], a[data-account-id], a[href*='/display/~']"
+
+// convertUserMentions converts Confluence user links into Outline mentions, or @Name text in
+// markdown. Users without a mapping are kept as text and reported.
+func convertUserMentions(content *goquery.Selection, title string, opts ConvertOptions, blocks *macroBlocks) {
+	content.Find(userLinkSelector).Each(func(i int, link *goquery.Selection) {
+		if mention, ok := userMention(link, title, opts); ok {
+			blocks.inline(link, mention)
+		}
+	})
+}
+
+// userMention returns the markdown mentioning the user of a user link.
+func userMention(link *goquery.Selection, title string, opts ConvertOptions) (string, bool) {
+	keys := userKeys(link)
+	if len(keys) == 0 {
+		return "", false
+	}
+
+	name := strings.Join(strings.Fields(link.Text()), " ")
+	if name == "" {
+		name = keys[0]
+	}
+
+	var user User
+	var mapped bool
+	for _, key := range keys {
+		if user, mapped = opts.Users[strings.ToLower(key)]; mapped {
+			break
+		}
+	}
+	if mapped && user.Name != "" {
+		name = user.Name
+	}
+	display := escape.MarkdownCharacters(name)
+
+	if opts.Target == TargetOutline {
+		if mapped && user.ID != "" {
+			return fmt.Sprintf("@[%s](mention://%s/user/%s)", display, newUUID(), user.ID), true
+		}
+		mapped = false
+	}
+
+	if !mapped && (opts.Users != nil || opts.Target == TargetOutline) {
+		opts.Report.Add(title, ReportUnmappedUser, keys[0]+" ("+name+")")
+	}
+	return "@" + display, true
+}
+
+// userKeys returns the username, user key and account id of a user link.
+func userKeys(link *goquery.Selection) []string {
+	var keys []string
+	for _, attr := range []string{"data-username", "data-user-key", "data-account-id"} {
+		if key := strings.TrimSpace(link.AttrOr(attr, "")); key != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	href := link.AttrOr("href", "")
+	if _, username, ok := strings.Cut(href, "/display/~"); ok {
+		if unescaped, err := url.PathUnescape(strings.Split(username, "?")[0]); err == nil && unescaped != "" {
+			keys = append(keys, unescaped)
+		}
+	}
+	if parsed, err := url.Parse(href); err == nil {
+		if username := parsed.Query().Get("username"); username != "" {
+			keys = append(keys, username)
+		}
+	}
+	return keys
+}
+
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -1,8 +1,17 @@
 package utils
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
 	"mime"
+	"net/http"
+	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 )
 
@@ -12,12 +21,108 @@ func CleanPath(path string) string {
 	return strings.ReplaceAll(path, "//", "/")
 }
 
+// GetMimeType determines the mime type of a file from user overrides, the known types and the
+// extension, sniffing the content when the extension is unknown. Files that cannot be classified
+// are application/octet-stream.
 func GetMimeType(filePath string) string {
-	ext := filepath.Ext(filePath)
-	mimeType := mime.TypeByExtension(ext)
-	if mimeType == "" {
-		// maybe we should return an error in the future
-		return ""
+	ext := strings.ToLower(filepath.Ext(filePath))
+	if mimeType, ok := mimeOverrides[ext]; ok {
+		return mimeType
 	}
-	return mimeType
+	if mimeType, ok := knownMimeTypes[ext]; ok {
+		return mimeType
+	}
+	if mimeType := mime.TypeByExtension(ext); ext != "" && mimeType != "" {
+		return mimeType
+	}
+	return sniffMimeType(filePath)
+}
+
+// RegisterMimeType overrides the mime type used for an extension, i.e. ".drawio".
+func RegisterMimeType(ext, mimeType string) {
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	mimeOverrides[strings.ToLower(ext)] = mimeType
+}
+
+func sniffMimeType(filePath string) string {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return octetStream
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(file, head)
+	head = head[:n]
+
+	switch {
+	case bytes.Contains(head, []byte("<mxfile")), bytes.Contains(head, []byte("<mxGraphModel")):
+		return knownMimeTypes[".drawio"]
+	case bytes.HasPrefix(head, []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}):
+		// ole compound files, i.e. .doc, .xls, .msg or .vsd
+		return "application/x-ole-storage"
+	}
+
+	return http.DetectContentType(head)
+}
+
+// HashFile returns the hex encoded sha256 of the file contents.
+func HashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+var sizeUnits = []string{"B", "KB", "MB", "GB", "TB"}
+
+// ParseSize parses human readable sizes such as "500MB" or "2 GB" using 1024 based units,
+// plain numbers are bytes.
+func ParseSize(size string) (int64, error) {
+	size = strings.ToUpper(strings.TrimSpace(size))
+	for i := len(sizeUnits) - 1; i >= 0; i-- {
+		if !strings.HasSuffix(size, sizeUnits[i]) {
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(size, sizeUnits[i])), 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			return 0, fmt.Errorf("invalid size %q", size)
+		}
+		if value < 0 {
+			return 0, fmt.Errorf("size %q cannot be negative", size)
+		}
+		return int64(value * math.Pow(1024, float64(i))), nil
+	}
+
+	value, err := strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+	if value < 0 {
+		return 0, fmt.Errorf("size %q cannot be negative", size)
+	}
+	return value, nil
+}
+
+// FormatSize formats a byte count using the largest fitting unit, i.e. "1.5 GB".
+func FormatSize(size int64) string {
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(sizeUnits)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d B", size)
+	}
+	return fmt.Sprintf("%.1f %s", value, sizeUnits[unit])
 }
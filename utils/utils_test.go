@@ -0,0 +1,39 @@
+package utils
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size    string
+		want    int64
+		wantErr bool
+	}{
+		{size: "1024", want: 1024},
+		{size: "0", want: 0},
+		{size: "10B", want: 10},
+		{size: "500MB", want: 500 << 20},
+		{size: "2 GB", want: 2 << 30},
+		{size: " 1kb ", want: 1024},
+		{size: "1.5KB", want: 1536},
+		{size: "1TB", want: 1 << 40},
+		{size: "-1", wantErr: true},
+		{size: "-5MB", wantErr: true},
+		{size: "NaNMB", wantErr: true},
+		{size: "InfGB", wantErr: true},
+		{size: "MB", wantErr: true},
+		{size: "ten", wantErr: true},
+		{size: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.size, func(t *testing.T) {
+			got, err := ParseSize(tt.size)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSize(%q) error = %v, wantErr %v", tt.size, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSize(%q) = %d, want %d", tt.size, got, tt.want)
+			}
+		})
+	}
+}
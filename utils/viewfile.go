@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"html"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// convertViewFiles adds an embed below the links of view file macros showing a pdf, when
+// asked to in markdown. Links within table cells are not followed by an embed.
+func convertViewFiles(content *goquery.Selection, opts ConvertOptions, blocks *macroBlocks) {
+	if !opts.EmbedPDFs || opts.Target != TargetMarkdown {
+		return
+	}
+
+	content.Find("a[data-view-file='pdf']").Each(func(i int, link *goquery.Selection) {
+		href := link.AttrOr("href", "")
+		if href == "" || link.ParentsFiltered("td, th").Length() > 0 {
+			return
+		}
+
+		embed := `<embed src="` + html.EscapeString(href) + `" type="application/pdf" width="100%" height="600" />`
+		block := link.Closest("p")
+		if block.Length() == 0 {
+			block = link
+		}
+		block.AfterHtml("<p>" + blocks.token(embed) + "</p>")
+	})
+}